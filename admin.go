@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultAdminListen = "127.0.0.1:9091"
+
+// adminTokenHeader carries the admin token on proxy requests that need it,
+// like the MCP logging/setLevel method
+const adminTokenHeader = "X-Admin-Token"
+
+// adminListen returns the address of the admin API listener
+func adminListen(cfg *AdminConfig) string {
+	if cfg.Listen != "" {
+		return cfg.Listen
+	}
+	return defaultAdminListen
+}
+
+// adminToken returns the bearer token of the admin API from the config
+func adminToken(cfg *AdminConfig) (string, error) {
+	token := cfg.Token
+	if token == "" && cfg.TokenEnv != "" {
+		token = os.Getenv(cfg.TokenEnv)
+		if token == "" {
+			return "", fmt.Errorf("environment variable %s is empty", cfg.TokenEnv)
+		}
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("an admin token is required")
+	}
+	return token, nil
+}
+
+// WithAdminToken enables the admin API for requests with the bearer token
+func WithAdminToken(token string) ServerOption {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// validAdminToken checks if token is the admin token
+func (s *Server) validAdminToken(token string) bool {
+	return token != "" && s.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+// requireAdmin rejects requests without the admin token. Browsers can send
+// the token as the password of basic authentication.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if _, password, ok := r.BasicAuth(); token == "" && ok {
+			token = password
+		}
+		if !s.validAdminToken(token) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mcp-proxy admin"`)
+			writeAdminError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminRoutes returns the handler serving the admin API
+func (s *Server) adminRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.requireAdmin(s.handleStatus))
+	mux.HandleFunc("GET /admin/servers", s.requireAdmin(s.handleListServers))
+	mux.HandleFunc("POST /admin/servers/{name}/enable", s.requireAdmin(s.handleEnableServer))
+	mux.HandleFunc("POST /admin/servers/{name}/disable", s.requireAdmin(s.handleDisableServer))
+	mux.HandleFunc("POST /admin/servers/{name}/restart", s.requireAdmin(s.handleRestartServer))
+	mux.HandleFunc("GET /admin/servers/{name}/stderr", s.requireAdmin(s.handleStderr))
+	mux.HandleFunc("POST /admin/cache/flush", s.requireAdmin(s.handleFlushCache))
+	mux.HandleFunc("GET /admin/health/servers", s.requireAdmin(s.handleAdminServerHealth))
+	mux.HandleFunc("GET /admin/drain", s.requireAdmin(s.handleGetDrain))
+	mux.HandleFunc("POST /admin/drain", s.requireAdmin(s.handleDrain))
+	mux.HandleFunc("DELETE /admin/drain", s.requireAdmin(s.handleUndrain))
+	mux.HandleFunc("GET /admin/logging", s.requireAdmin(s.handleGetLogging))
+	mux.HandleFunc("PUT /admin/logging", s.requireAdmin(s.handlePutLogging))
+	return mux
+}
+
+// handleListServers serves GET /admin/servers with the status of all
+// configured servers
+func (s *Server) handleListServers(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, map[string]interface{}{
+		"servers":  s.upstreamStatuses(),
+		"draining": s.draining.Load(),
+		"inFlight": s.inFlight.Load(),
+	})
+}
+
+// handleEnableServer serves POST /admin/servers/{name}/enable
+func (s *Server) handleEnableServer(w http.ResponseWriter, r *http.Request) {
+	s.manageServer(w, r, s.EnableServer)
+}
+
+// handleDisableServer serves POST /admin/servers/{name}/disable
+func (s *Server) handleDisableServer(w http.ResponseWriter, r *http.Request) {
+	s.manageServer(w, r, s.DisableServer)
+}
+
+// handleRestartServer serves POST /admin/servers/{name}/restart
+func (s *Server) handleRestartServer(w http.ResponseWriter, r *http.Request) {
+	s.manageServer(w, r, s.RestartServer)
+}
+
+// manageServer runs a server management operation and responds with the
+// resulting status of the server
+func (s *Server) manageServer(w http.ResponseWriter, r *http.Request, op func(ctx context.Context, name string) error) {
+	name := r.PathValue("name")
+
+	// Started clients outlive the request
+	if err := op(context.WithoutCancel(r.Context()), name); err != nil {
+		status := http.StatusBadGateway
+		var httpErr *httpError
+		if errors.As(err, &httpErr) {
+			status = httpErr.status
+		}
+		writeAdminError(w, status, s.redactedError(err))
+		return
+	}
+
+	for _, status := range s.upstreamStatuses() {
+		if status.Name == name {
+			writeAdminJSON(w, status)
+			return
+		}
+	}
+	writeAdminError(w, http.StatusNotFound, "unknown server")
+}
+
+// handleFlushCache serves POST /admin/cache/flush, which drops the cached tool
+// lists of all servers, or of the server in the "server" query parameter
+func (s *Server) handleFlushCache(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("server")
+	if name != "" {
+		if _, err := s.upstream(name); err != nil {
+			writeAdminError(w, http.StatusNotFound, "unknown server")
+			return
+		}
+	}
+	s.flushToolsCache(name)
+	s.logger.InfoContext(r.Context(), "Tools cache flushed", "server_name", name)
+	writeAdminJSON(w, map[string]interface{}{"flushed": true})
+}
+
+// handleGetDrain serves GET /admin/drain with the drain state
+func (s *Server) handleGetDrain(w http.ResponseWriter, r *http.Request) {
+	s.writeDrainState(w)
+}
+
+// handleDrain serves POST /admin/drain. New requests are rejected and the
+// readiness check fails until the drain is cancelled. With a "wait" duration
+// parameter, it responds once the requests in flight are done or the wait is over.
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	var wait time.Duration
+	if v := r.URL.Query().Get("wait"); v != "" {
+		var err error
+		wait, err = time.ParseDuration(v)
+		if err != nil || wait < 0 {
+			writeAdminError(w, http.StatusBadRequest, "invalid wait duration")
+			return
+		}
+	}
+
+	if !s.draining.Swap(true) {
+		s.logger.InfoContext(r.Context(), "Draining requests", "in_flight", s.inFlight.Load())
+	}
+
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for wait > 0 && s.inFlight.Load() > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline.C:
+			wait = 0
+		case <-ticker.C:
+		}
+	}
+	s.writeDrainState(w)
+}
+
+// handleUndrain serves DELETE /admin/drain, which accepts requests again
+func (s *Server) handleUndrain(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Swap(false) {
+		s.logger.InfoContext(r.Context(), "Drain cancelled")
+	}
+	s.writeDrainState(w)
+}
+
+func (s *Server) writeDrainState(w http.ResponseWriter) {
+	writeAdminJSON(w, map[string]interface{}{
+		"draining": s.draining.Load(),
+		"inFlight": s.inFlight.Load(),
+	})
+}
+
+// handleStderr serves GET /admin/servers/{name}/stderr with the recent
+// stderr lines of the server's subprocess. The lines of configured servers
+// are kept when they crash or fail to start.
+func (s *Server) handleStderr(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	s.initMu.RLock()
+	var buffer *stderrBuffer
+	state, configured := s.upstreams[name]
+	client, running := s.mcpClients[name]
+	switch {
+	case running:
+		buffer = client.stderr
+	case configured:
+		buffer = state.stderr
+	}
+	s.initMu.RUnlock()
+	if !configured && !running {
+		writeAdminError(w, http.StatusNotFound, "unknown server")
+		return
+	}
+
+	writeAdminJSON(w, map[string]interface{}{
+		"server": name,
+		"lines":  buffer.snapshot(),
+	})
+}
+
+// handleGetLogging serves GET /admin/logging with the current log levels
+func (s *Server) handleGetLogging(w http.ResponseWriter, r *http.Request) {
+	writeLogLevels(w)
+}
+
+// handlePutLogging serves PUT /admin/logging, which changes the base log level
+// and component overrides. An empty component level removes the override.
+func (s *Server) handlePutLogging(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Level      string            `json:"level"`
+		Components map[string]string `json:"components"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var base *slog.Level
+	if body.Level != "" {
+		level, err := parseLogLevel(body.Level)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		base = &level
+	}
+	components := make(map[string]*slog.Level, len(body.Components))
+	for name, value := range body.Components {
+		if value == "" {
+			components[name] = nil
+			continue
+		}
+		level, err := parseLogLevel(value)
+		if err != nil {
+			writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("component %s: %v", name, err))
+			return
+		}
+		components[name] = &level
+	}
+
+	levels.update(base, components)
+	s.logger.InfoContext(r.Context(), "Log levels changed", "level", body.Level, "components", body.Components)
+	writeLogLevels(w)
+}
+
+func writeLogLevels(w http.ResponseWriter) {
+	base, components := levelNames(levels)
+	writeAdminJSON(w, map[string]interface{}{
+		"level":      base,
+		"components": components,
+	})
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
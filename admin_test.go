@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminToken(t *testing.T) {
+	t.Setenv("TEST_ADMIN_TOKEN", "from-env")
+	tests := []struct {
+		name     string
+		config   AdminConfig
+		expected string
+		wantErr  bool
+	}{
+		{name: "Token", config: AdminConfig{Token: " secret "}, expected: "secret"},
+		{name: "Token from env", config: AdminConfig{TokenEnv: "TEST_ADMIN_TOKEN"}, expected: "from-env"},
+		{name: "Empty env", config: AdminConfig{TokenEnv: "TEST_ADMIN_TOKEN_MISSING"}, wantErr: true},
+		{name: "No token", config: AdminConfig{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := adminToken(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("adminToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("adminToken() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAdminStderrEndpoint(t *testing.T) {
+	client := newInProcessMCPClient(t, &MCPClientConfig{}, echoMetaTool())
+	client.stderr = newStderrBuffer(10)
+	client.logStderr("warming up")
+	server := NewServer(map[string]*MCPClient{"a": client}, false, WithAdminToken("admin-secret"))
+	handler := server.adminRoutes()
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		statusCode int
+	}{
+		{name: "Missing token", path: "/admin/servers/a/stderr", statusCode: http.StatusUnauthorized},
+		{name: "Wrong token", path: "/admin/servers/a/stderr", token: "nope", statusCode: http.StatusUnauthorized},
+		{name: "Unknown server", path: "/admin/servers/zzz/stderr", token: "admin-secret", statusCode: http.StatusNotFound},
+		{name: "Lines", path: "/admin/servers/a/stderr", token: "admin-secret", statusCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			var body struct {
+				Server string       `json:"server"`
+				Lines  []stderrLine `json:"lines"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if body.Server != "a" || len(body.Lines) != 1 || body.Lines[0].Message != "warming up" || body.Lines[0].Level != "WARN" {
+				t.Errorf("unexpected response %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminStderrOfFailedServer(t *testing.T) {
+	server := NewServer(map[string]*MCPClient{}, false, WithAdminToken("admin-secret"), WithInitTimeout(300*time.Millisecond))
+	server.StartClients(context.Background(), map[string]*MCPClientConfig{
+		"broken": {Name: "broken", Command: "sh", Args: []string{"-c", "echo missing API key >&2; exit 1"}},
+	})
+	if _, running := server.clients()["broken"]; running {
+		t.Fatal("expected the server to fail to start")
+	}
+
+	w := doAdmin(server, "GET", "/admin/servers/broken/stderr")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "missing API key") {
+		t.Errorf("expected the stderr lines of the failed start, got %s", w.Body.String())
+	}
+}
+
+func TestAdminAPINotOnProxyListener(t *testing.T) {
+	client := newInProcessMCPClient(t, &MCPClientConfig{}, echoMetaTool())
+	server := NewServer(map[string]*MCPClient{"a": client}, false, WithAdminToken("admin-secret"))
+
+	req := httptest.NewRequest("GET", "/admin/servers/a/stderr", nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Errorf("expected the admin API to be served on its own listener only, got status %d", w.Code)
+	}
+}
+
+func TestAdminAPIRequiresToken(t *testing.T) {
+	server := NewServer(map[string]*MCPClient{}, false)
+
+	w := httptest.NewRecorder()
+	server.adminRoutes().ServeHTTP(w, httptest.NewRequest("GET", "/admin/servers", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without an admin token, got %d", w.Code)
+	}
+}
+
+func TestAdminLoggingEndpoint(t *testing.T) {
+	restoreLogLevels(t)
+	levels.set(slog.LevelInfo, map[string]slog.Level{"server": slog.LevelWarn})
+	client := newInProcessMCPClient(t, &MCPClientConfig{}, echoMetaTool())
+	handler := NewServer(map[string]*MCPClient{"a": client}, false, WithAdminToken("admin-secret")).adminRoutes()
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{name: "Get", method: "GET", statusCode: http.StatusOK, expected: `{"components":{"server":"warn"},"level":"info"}`},
+		{name: "Invalid level", method: "PUT", body: `{"level":"loud"}`, statusCode: http.StatusBadRequest},
+		{name: "Invalid component level", method: "PUT", body: `{"components":{"server":"loud"}}`, statusCode: http.StatusBadRequest},
+		{name: "Invalid body", method: "PUT", body: `{`, statusCode: http.StatusBadRequest},
+		{name: "Set levels", method: "PUT", body: `{"level":"debug","components":{"mcp_client":"error","server":""}}`, statusCode: http.StatusOK, expected: `{"components":{"mcp_client":"error"},"level":"debug"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/logging", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer admin-secret")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+			if tt.expected != "" && strings.TrimSpace(w.Body.String()) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminShutdownWhileStarting(t *testing.T) {
+	server := NewServer(map[string]*MCPClient{}, false, WithAdminToken("admin-secret"))
+	server.server = &http.Server{}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.StartAdmin("127.0.0.1:0")
+	}()
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("expected the admin API to be closed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the admin API to stop after Shutdown")
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultApprovalTimeout = 5 * time.Minute
+	approvalWebhookTimeout = 10 * time.Second
+)
+
+// ApprovalManager holds tool calls that need approval until an approver
+// approves or rejects them
+type ApprovalManager struct {
+	timeout         time.Duration
+	token           string
+	webhookURL      string
+	webhookHeaders  map[string]string
+	callbackBaseURL string
+	redactor        *Redactor
+	httpClient      *http.Client
+	logger          *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+}
+
+// pendingApproval is a tool call waiting for a decision
+type pendingApproval struct {
+	ID        string                 `json:"id"`
+	Server    string                 `json:"server"`
+	Tool      string                 `json:"tool"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Caller    *Caller                `json:"caller,omitempty"`
+	CreatedAt time.Time              `json:"createdAt"`
+	ExpiresAt time.Time              `json:"expiresAt"`
+
+	// Secret that lets the webhook receiver decide on this call only
+	callbackToken string
+	decision      chan approvalDecision
+}
+
+// approvalDecision is the body approvers send to decide on a pending call
+type approvalDecision struct {
+	Decision string `json:"decision"`
+	Approver string `json:"approver,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func (d approvalDecision) approved() bool {
+	return d.Decision == "approve"
+}
+
+// NewApprovalManager creates an approval manager from the approval config.
+// Arguments shown to approvers are redacted with the redactor, if any.
+func NewApprovalManager(cfg *ApprovalConfig, redactor *Redactor) (*ApprovalManager, error) {
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+
+	token := cfg.Token
+	if token == "" && cfg.TokenEnv != "" {
+		token = os.Getenv(cfg.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("environment variable %s is empty", cfg.TokenEnv)
+		}
+	}
+	if token == "" && cfg.WebhookURL == "" {
+		return nil, fmt.Errorf("either an approver token or a webhook URL is required")
+	}
+
+	return &ApprovalManager{
+		timeout:         timeout,
+		token:           strings.TrimSpace(token),
+		webhookURL:      cfg.WebhookURL,
+		webhookHeaders:  cfg.WebhookHeaders,
+		callbackBaseURL: strings.TrimSuffix(cfg.CallbackBaseURL, "/"),
+		redactor:        redactor,
+		httpClient:      &http.Client{Timeout: approvalWebhookTimeout},
+		logger:          WithComponent("approval"),
+		pending:         make(map[string]*pendingApproval),
+	}, nil
+}
+
+// requiresApproval checks if calls to the tool must be approved first
+func (c *MCPClient) requiresApproval(toolName string) bool {
+	if c.config.Extensions == nil {
+		return false
+	}
+	for _, name := range c.config.Extensions.Tools.RequireApproval {
+		if name == toolName {
+			return true
+		}
+	}
+	return false
+}
+
+// await holds the tool call until it is approved. It returns an error if the
+// call is rejected, times out or the client goes away.
+func (m *ApprovalManager) await(ctx context.Context, serverName, toolName string, args map[string]interface{}) error {
+	if m == nil {
+		return newApprovalRejectedError("", "approval is not configured for this proxy", "")
+	}
+
+	now := time.Now()
+	p := &pendingApproval{
+		ID:            randomHex(16),
+		Server:        serverName,
+		Tool:          toolName,
+		Arguments:     m.redactor.redactArguments(args),
+		Caller:        callerFromContext(ctx),
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(m.timeout),
+		callbackToken: randomHex(32),
+		decision:      make(chan approvalDecision, 1),
+	}
+
+	m.mu.Lock()
+	m.pending[p.ID] = p
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, p.ID)
+		m.mu.Unlock()
+	}()
+
+	m.logger.InfoContext(ctx, "Tool call waiting for approval",
+		"approval_id", p.ID,
+		"caller", callerID(ctx),
+		"server", serverName,
+		"tool", toolName)
+
+	if m.webhookURL != "" {
+		go m.notify(p)
+	}
+
+	timer := time.NewTimer(m.timeout)
+	defer timer.Stop()
+
+	select {
+	case d := <-p.decision:
+		if d.approved() {
+			m.logger.InfoContext(ctx, "Tool call approved", "approval_id", p.ID, "approver", d.Approver)
+			return nil
+		}
+		m.logger.InfoContext(ctx, "Tool call rejected", "approval_id", p.ID, "approver", d.Approver, "reason", d.Reason)
+		reason := d.Reason
+		if reason == "" {
+			reason = "rejected by approver"
+		}
+		return newApprovalRejectedError(p.ID, reason, d.Approver)
+	case <-timer.C:
+		m.logger.WarnContext(ctx, "Tool call approval timed out", "approval_id", p.ID, "timeout", m.timeout.String())
+		return newApprovalRejectedError(p.ID, "approval timed out", "")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// decide delivers the decision to the pending call. It returns false if the
+// call is unknown or was already decided.
+func (m *ApprovalManager) decide(id string, d approvalDecision) bool {
+	m.mu.Lock()
+	p, ok := m.pending[id]
+	if ok {
+		delete(m.pending, id)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return false
+	}
+	p.decision <- d
+	return true
+}
+
+// notify sends the pending call to the webhook. If the webhook answers with a
+// decision, it is applied right away.
+func (m *ApprovalManager) notify(p *pendingApproval) {
+	payload := struct {
+		*pendingApproval
+		CallbackURL   string `json:"callbackUrl,omitempty"`
+		CallbackToken string `json:"callbackToken"`
+	}{
+		pendingApproval: p,
+		CallbackToken:   p.callbackToken,
+	}
+	if m.callbackBaseURL != "" {
+		payload.CallbackURL = m.callbackBaseURL + "/approvals/" + p.ID
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		m.logger.Error("Failed to encode approval webhook", "approval_id", p.ID, "error", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, m.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		m.logger.Error("Failed to create approval webhook request", "approval_id", p.ID, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range m.webhookHeaders {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		m.logger.Error("Failed to send approval webhook", "approval_id", p.ID, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		m.logger.Error("Approval webhook failed", "approval_id", p.ID, "status", resp.StatusCode)
+		return
+	}
+
+	var d approvalDecision
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil || len(bytes.TrimSpace(buf)) == 0 || json.Unmarshal(buf, &d) != nil {
+		return
+	}
+	if d.Decision == "approve" || d.Decision == "reject" {
+		m.decide(p.ID, d)
+	}
+}
+
+// list returns the pending calls, oldest first
+func (m *ApprovalManager) list() []*pendingApproval {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending := make([]*pendingApproval, 0, len(m.pending))
+	for _, p := range m.pending {
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	return pending
+}
+
+// handleList serves GET /approvals
+func (m *ApprovalManager) handleList(w http.ResponseWriter, r *http.Request) {
+	if !m.isApprover(r) {
+		writeApprovalError(w, http.StatusUnauthorized, "invalid approver token")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"pending": m.list()})
+}
+
+// handleDecision serves POST /approvals/{id}. Approvers authenticate with the
+// approver token, webhook receivers with the callback token of the call.
+func (m *ApprovalManager) handleDecision(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	m.mu.Lock()
+	p, ok := m.pending[id]
+	m.mu.Unlock()
+
+	token := bearerToken(r)
+	authorized := m.isApprover(r) || (ok && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(p.callbackToken)) == 1)
+	if !authorized {
+		writeApprovalError(w, http.StatusUnauthorized, "invalid approver token")
+		return
+	}
+	if !ok {
+		writeApprovalError(w, http.StatusNotFound, "no pending call with this id")
+		return
+	}
+
+	var d approvalDecision
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&d); err != nil {
+		writeApprovalError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if d.Decision != "approve" && d.Decision != "reject" {
+		writeApprovalError(w, http.StatusBadRequest, `decision must be "approve" or "reject"`)
+		return
+	}
+
+	if !m.decide(id, d) {
+		writeApprovalError(w, http.StatusNotFound, "no pending call with this id")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": id, "decision": d.Decision})
+}
+
+// isApprover checks if the request carries the approver token
+func (m *ApprovalManager) isApprover(r *http.Request) bool {
+	token := bearerToken(r)
+	return m.token != "" && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(m.token)) == 1
+}
+
+func writeApprovalError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// newApprovalRejectedError creates the JSON-RPC error returned when a call is not approved
+func newApprovalRejectedError(id, reason, approver string) *rpcError {
+	data := map[string]interface{}{"reason": reason}
+	if id != "" {
+		data["approvalId"] = id
+	}
+	if approver != "" {
+		data["approver"] = approver
+	}
+	return &rpcError{
+		code:    errCodeApprovalRejected,
+		message: "Approval rejected",
+		data:    data,
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
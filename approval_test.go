@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+func TestNewApprovalManager(t *testing.T) {
+	t.Setenv("TEST_APPROVER_TOKEN", "env-token")
+
+	tests := []struct {
+		name    string
+		config  ApprovalConfig
+		wantErr bool
+	}{
+		{name: "Token", config: ApprovalConfig{Token: "token"}},
+		{name: "Token from env", config: ApprovalConfig{TokenEnv: "TEST_APPROVER_TOKEN"}},
+		{name: "Webhook only", config: ApprovalConfig{WebhookURL: "https://example.com/hook"}},
+		{name: "Empty token env", config: ApprovalConfig{TokenEnv: "TEST_UNSET_APPROVER_TOKEN"}, wantErr: true},
+		{name: "No way to approve", config: ApprovalConfig{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewApprovalManager(&tt.config, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewApprovalManager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newApprovalTestServer returns a split mode server whose "deploy" tool requires approval
+func newApprovalTestServer(t *testing.T, cfg *ApprovalConfig) (*Server, http.Handler) {
+	t.Helper()
+	deploy := mcpserver.ServerTool{
+		Tool: mcp.NewTool("deploy"),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("deployed"), nil
+		},
+	}
+	client := newInProcessMCPClient(t, &MCPClientConfig{
+		Extensions: &Extensions{Tools: ToolsExtensions{RequireApproval: []string{"deploy"}}},
+	}, deploy)
+
+	var opts []ServerOption
+	if cfg != nil {
+		approvals, err := NewApprovalManager(cfg, nil)
+		if err != nil {
+			t.Fatalf("NewApprovalManager failed: %v", err)
+		}
+		opts = append(opts, WithApprovals(approvals))
+	}
+	server := NewServer(map[string]*MCPClient{"ops": client}, true, opts...)
+	return server, server.routes()
+}
+
+// callDeploy calls the deploy tool in the background and returns a channel with the response
+func callDeploy(handler http.Handler) <-chan JSONRPCResponse {
+	done := make(chan JSONRPCResponse, 1)
+	go func() {
+		req := httptest.NewRequest("POST", "/ops", strings.NewReader(`{"jsonrpc":"2.0","method":"tools/call","params":{"name":"deploy","arguments":{"version":"1.2.3"}},"id":1}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp JSONRPCResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		done <- resp
+	}()
+	return done
+}
+
+// waitForPending waits until a call is pending and returns it
+func waitForPending(t *testing.T, server *Server) *pendingApproval {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if pending := server.approvals.list(); len(pending) > 0 {
+			return pending[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("no call is pending approval")
+	return nil
+}
+
+func postDecision(handler http.Handler, id, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/approvals/"+id, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestApprovalApproved(t *testing.T) {
+	server, handler := newApprovalTestServer(t, &ApprovalConfig{Token: "approver-token"})
+	done := callDeploy(handler)
+	pending := waitForPending(t, server)
+
+	// The pending call is listed for approvers only
+	req := httptest.NewRequest("GET", "/approvals", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without approver token, got %d", w.Code)
+	}
+	req.Header.Set("Authorization", "Bearer approver-token")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"tool":"deploy"`) || !strings.Contains(w.Body.String(), `"version":"1.2.3"`) {
+		t.Errorf("expected pending call in list, got %s", w.Body.String())
+	}
+
+	if w := postDecision(handler, pending.ID, "wrong-token", `{"decision":"approve"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with wrong token, got %d", w.Code)
+	}
+	if w := postDecision(handler, pending.ID, "approver-token", `{"decision":"maybe"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid decision, got %d", w.Code)
+	}
+	select {
+	case <-done:
+		t.Fatal("call finished before it was approved")
+	default:
+	}
+
+	if w := postDecision(handler, pending.ID, "approver-token", `{"decision":"approve","approver":"carol"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	resp := <-done
+	if resp.Error != nil {
+		t.Fatalf("expected approved call to succeed, got %+v", resp.Error)
+	}
+	result, _ := json.Marshal(resp.Result)
+	if !strings.Contains(string(result), "deployed") {
+		t.Errorf("expected tool result, got %s", result)
+	}
+
+	if w := postDecision(handler, pending.ID, "approver-token", `{"decision":"approve"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for decided call, got %d", w.Code)
+	}
+}
+
+func TestApprovalRejected(t *testing.T) {
+	server, handler := newApprovalTestServer(t, &ApprovalConfig{Token: "approver-token"})
+	done := callDeploy(handler)
+	pending := waitForPending(t, server)
+
+	postDecision(handler, pending.ID, "approver-token", `{"decision":"reject","approver":"carol","reason":"change freeze"}`)
+
+	resp := <-done
+	if resp.Error == nil || resp.Error.Code != errCodeApprovalRejected {
+		t.Fatalf("expected approval rejected error, got %+v", resp)
+	}
+	data, _ := json.Marshal(resp.Error.Data)
+	if !strings.Contains(string(data), `"reason":"change freeze"`) || !strings.Contains(string(data), `"approver":"carol"`) {
+		t.Errorf("unexpected error data %s", data)
+	}
+}
+
+func TestApprovalTimeout(t *testing.T) {
+	_, handler := newApprovalTestServer(t, &ApprovalConfig{Token: "approver-token", Timeout: Duration(50 * time.Millisecond)})
+
+	resp := <-callDeploy(handler)
+	if resp.Error == nil || resp.Error.Code != errCodeApprovalRejected {
+		t.Fatalf("expected approval rejected error, got %+v", resp)
+	}
+	data, _ := json.Marshal(resp.Error.Data)
+	if !strings.Contains(string(data), "timed out") {
+		t.Errorf("expected timeout reason, got %s", data)
+	}
+}
+
+func TestApprovalNotConfigured(t *testing.T) {
+	_, handler := newApprovalTestServer(t, nil)
+
+	resp := <-callDeploy(handler)
+	if resp.Error == nil || resp.Error.Code != errCodeApprovalRejected {
+		t.Fatalf("expected approval rejected error, got %+v", resp)
+	}
+}
+
+func TestApprovalWebhookCallback(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Webhook-Secret") != "s3cret" {
+			t.Errorf("expected webhook header, got %q", r.Header.Get("X-Webhook-Secret"))
+		}
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer webhook.Close()
+
+	_, handler := newApprovalTestServer(t, &ApprovalConfig{
+		WebhookURL:      webhook.URL,
+		WebhookHeaders:  map[string]string{"X-Webhook-Secret": "s3cret"},
+		CallbackBaseURL: "https://proxy.example.com/",
+	})
+	done := callDeploy(handler)
+
+	payload := <-received
+	id, _ := payload["id"].(string)
+	if payload["callbackUrl"] != "https://proxy.example.com/approvals/"+id {
+		t.Errorf("unexpected callback URL %v", payload["callbackUrl"])
+	}
+	callbackToken, _ := payload["callbackToken"].(string)
+
+	// The callback token only works for its own call
+	if w := postDecision(handler, "other-id", callbackToken, `{"decision":"approve"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for other call, got %d", w.Code)
+	}
+	if w := postDecision(handler, id, callbackToken, `{"decision":"approve"}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if resp := <-done; resp.Error != nil {
+		t.Errorf("expected approved call to succeed, got %+v", resp.Error)
+	}
+}
+
+func TestApprovalWebhookDecision(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"decision":"reject","approver":"policy-bot","reason":"outside business hours"}`))
+	}))
+	defer webhook.Close()
+
+	_, handler := newApprovalTestServer(t, &ApprovalConfig{WebhookURL: webhook.URL})
+
+	resp := <-callDeploy(handler)
+	if resp.Error == nil || resp.Error.Code != errCodeApprovalRejected {
+		t.Fatalf("expected approval rejected error, got %+v", resp)
+	}
+	data, _ := json.Marshal(resp.Error.Data)
+	if !strings.Contains(string(data), "outside business hours") {
+		t.Errorf("unexpected error data %s", data)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	auditSinkFile   = "file"
+	auditSinkStdout = "stdout"
+)
+
+// Outcomes of a tool call in the audit log
+const (
+	auditStatusOK        = "ok"
+	auditStatusToolError = "tool_error"
+	auditStatusRejected  = "rejected"
+	auditStatusError     = "error"
+)
+
+// AuditLogger records every tool call
+type AuditLogger struct {
+	includeArguments bool
+	redactor         *Redactor
+	file             *rotatingWriter
+	logger           *slog.Logger
+}
+
+// auditRecord is one entry of the audit log
+type auditRecord struct {
+	Time          time.Time              `json:"time"`
+	RequestID     string                 `json:"requestId,omitempty"`
+	Caller        string                 `json:"caller,omitempty"`
+	ClientIP      string                 `json:"clientIp,omitempty"`
+	Server        string                 `json:"server,omitempty"`
+	Tool          string                 `json:"tool"`
+	ArgumentsHash string                 `json:"argumentsHash"`
+	Arguments     map[string]interface{} `json:"arguments,omitempty"`
+	Status        string                 `json:"status"`
+	IsError       bool                   `json:"isError"`
+	ErrorCode     int                    `json:"errorCode,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+	LatencyMs     float64                `json:"latencyMs"`
+	ResponseBytes int                    `json:"responseBytes"`
+}
+
+// NewAuditLogger creates an audit logger writing to the sink of the config.
+// Recorded arguments and errors are redacted with the redactor, if any.
+func NewAuditLogger(cfg *AuditConfig, redactor *Redactor) (*AuditLogger, error) {
+	a := &AuditLogger{includeArguments: cfg.IncludeArguments, redactor: redactor}
+
+	switch cfg.Sink {
+	case auditSinkFile:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("path is required for the file sink")
+		}
+		file, err := newRotatingWriter(cfg.Path, cfg.MaxSizeMB, cfg.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		a.file = file
+		a.logger = WithComponent("audit")
+	case "", auditSinkStdout:
+		// Records must not be dropped when the log level is raised
+		a.logger = WithUnfilteredComponent("audit")
+	default:
+		return nil, fmt.Errorf("invalid audit sink %q", cfg.Sink)
+	}
+
+	return a, nil
+}
+
+// record writes the audit record of a finished tool call
+func (a *AuditLogger) record(ctx context.Context, serverName, toolName string, args map[string]interface{}, result *mcp.CallToolResult, err error, latency time.Duration) {
+	if a == nil {
+		return
+	}
+
+	rec := auditRecord{
+		Time:          time.Now().UTC(),
+		RequestID:     requestIDFromContext(ctx),
+		Caller:        callerID(ctx),
+		ClientIP:      clientIPFromContext(ctx),
+		Server:        serverName,
+		Tool:          toolName,
+		ArgumentsHash: hashArguments(args),
+		LatencyMs:     float64(latency.Microseconds()) / 1000,
+	}
+	if a.includeArguments {
+		rec.Arguments = a.redactor.redactArguments(args)
+	}
+
+	rec.Status, rec.ErrorCode = callStatus(result, err)
+	if err != nil {
+		rec.Error = a.redactor.redactString(err.Error())
+	}
+	rec.IsError = rec.Status == auditStatusToolError
+	if result != nil {
+		if b, err := json.Marshal(result); err == nil {
+			rec.ResponseBytes = len(b)
+		}
+	}
+
+	a.write(ctx, rec)
+}
+
+// callStatus classifies the outcome of a tool call. It also returns the
+// JSON-RPC error code if the call failed with one.
+func callStatus(result *mcp.CallToolResult, err error) (string, int) {
+	switch {
+	case err != nil:
+		var rpcErr *rpcError
+		if !errors.As(err, &rpcErr) {
+			return auditStatusError, 0
+		}
+		switch rpcErr.code {
+		case errCodeForbidden, errCodeApprovalRejected, errCodeRateLimited:
+			return auditStatusRejected, rpcErr.code
+		}
+		return auditStatusError, rpcErr.code
+	case result != nil && result.IsError:
+		return auditStatusToolError, 0
+	default:
+		return auditStatusOK, 0
+	}
+}
+
+// write writes the record to the sink. Records of the stdout sink get the
+// request ID of ctx from the log handler.
+func (a *AuditLogger) write(ctx context.Context, rec auditRecord) {
+	if a.file == nil {
+		a.logger.LogAttrs(ctx, slog.LevelInfo, "Tool call",
+			slog.String("caller", rec.Caller),
+			slog.String("client_ip", rec.ClientIP),
+			slog.String("server", rec.Server),
+			slog.String("tool", rec.Tool),
+			slog.String("arguments_hash", rec.ArgumentsHash),
+			slog.Any("arguments", rec.Arguments),
+			slog.String("status", rec.Status),
+			slog.Bool("is_error", rec.IsError),
+			slog.Int("error_code", rec.ErrorCode),
+			slog.String("error", rec.Error),
+			slog.Float64("latency_ms", rec.LatencyMs),
+			slog.Int("response_bytes", rec.ResponseBytes),
+		)
+		return
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		a.logger.ErrorContext(ctx, "Failed to encode audit record", "error", err)
+		return
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		a.logger.ErrorContext(ctx, "Failed to write audit record", "error", err)
+	}
+}
+
+// Close closes the audit log file, if any
+func (a *AuditLogger) Close() error {
+	if a == nil || a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// hashArguments returns the SHA-256 of the JSON encoded arguments. Map keys
+// are sorted by encoding/json, so equal arguments have equal hashes.
+func hashArguments(args map[string]interface{}) string {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNewAuditLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  AuditConfig
+		wantErr bool
+	}{
+		{name: "Stdout sink", config: AuditConfig{Sink: "stdout"}},
+		{name: "Default sink", config: AuditConfig{}},
+		{name: "File sink", config: AuditConfig{Sink: "file", Path: filepath.Join(t.TempDir(), "audit.jsonl")}},
+		{name: "File sink without path", config: AuditConfig{Sink: "file"}, wantErr: true},
+		{name: "File in missing directory", config: AuditConfig{Sink: "file", Path: filepath.Join(t.TempDir(), "missing", "audit.jsonl")}, wantErr: true},
+		{name: "Unknown sink", config: AuditConfig{Sink: "syslog"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audit, err := NewAuditLogger(&tt.config, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAuditLogger() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			audit.Close()
+		})
+	}
+}
+
+// readAuditRecords reads the records of a JSONL audit file
+func readAuditRecords(t *testing.T, path string) []auditRecord {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestAuditRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := NewAuditLogger(&AuditConfig{Sink: "file", Path: path}, nil)
+	if err != nil {
+		t.Fatalf("NewAuditLogger failed: %v", err)
+	}
+	defer audit.Close()
+
+	ctx := withCaller(withRequestID(context.Background(), "req-1"), &Caller{ID: "alice"})
+	args := map[string]interface{}{"query": "select 1"}
+
+	audit.record(ctx, "db", "query", args, mcp.NewToolResultText("1"), nil, 1500*time.Microsecond)
+	audit.record(ctx, "db", "query", args, mcp.NewToolResultError("syntax error"), nil, time.Millisecond)
+	audit.record(ctx, "db", "drop", nil, nil, newForbiddenError("no"), 0)
+	audit.record(ctx, "db", "query", args, nil, context.DeadlineExceeded, time.Second)
+
+	records := readAuditRecords(t, path)
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+
+	first := records[0]
+	if first.Caller != "alice" || first.RequestID != "req-1" || first.Server != "db" || first.Tool != "query" {
+		t.Errorf("unexpected record %+v", first)
+	}
+	if first.Status != auditStatusOK || first.IsError || first.LatencyMs != 1.5 || first.ResponseBytes == 0 {
+		t.Errorf("unexpected outcome %+v", first)
+	}
+	if first.ArgumentsHash != hashArguments(args) || first.Arguments != nil {
+		t.Errorf("expected only the hash of the arguments, got %+v", first)
+	}
+
+	expected := []struct {
+		status    string
+		isError   bool
+		errorCode int
+	}{
+		{auditStatusOK, false, 0},
+		{auditStatusToolError, true, 0},
+		{auditStatusRejected, false, errCodeForbidden},
+		{auditStatusError, false, 0},
+	}
+	for i, want := range expected {
+		rec := records[i]
+		if rec.Status != want.status || rec.IsError != want.isError || rec.ErrorCode != want.errorCode {
+			t.Errorf("record %d: status=%s isError=%v errorCode=%d, want %+v", i, rec.Status, rec.IsError, rec.ErrorCode, want)
+		}
+	}
+}
+
+func TestAuditIncludeArguments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := NewAuditLogger(&AuditConfig{Sink: "file", Path: path, IncludeArguments: true}, nil)
+	if err != nil {
+		t.Fatalf("NewAuditLogger failed: %v", err)
+	}
+	defer audit.Close()
+
+	audit.record(context.Background(), "db", "query", map[string]interface{}{"query": "select 1"}, nil, nil, 0)
+
+	records := readAuditRecords(t, path)
+	if len(records) != 1 || records[0].Arguments["query"] != "select 1" {
+		t.Errorf("expected arguments in the record, got %+v", records)
+	}
+}
+
+func TestHashArguments(t *testing.T) {
+	a := hashArguments(map[string]interface{}{"a": 1, "b": "x"})
+	b := hashArguments(map[string]interface{}{"b": "x", "a": 1})
+	if a != b {
+		t.Error("expected the hash not to depend on key order")
+	}
+	if a == hashArguments(map[string]interface{}{"a": 2, "b": "x"}) {
+		t.Error("expected different arguments to have different hashes")
+	}
+	if hashArguments(nil) != hashArguments(map[string]interface{}{}) {
+		t.Error("expected no arguments to hash like empty arguments")
+	}
+}
+
+func TestAuditToolCalls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := NewAuditLogger(&AuditConfig{Sink: "file", Path: path}, nil)
+	if err != nil {
+		t.Fatalf("NewAuditLogger failed: %v", err)
+	}
+	defer audit.Close()
+
+	server := newScopedTestServer(t, false)
+	server.audit = audit
+
+	doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"search_issues","arguments":{"q":"bug"}},"id":1}`)
+	doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"delete_issue"},"id":2}`)
+	doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"missing"},"id":3}`)
+	doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/list","id":4}`)
+
+	records := readAuditRecords(t, path)
+	if len(records) != 3 {
+		t.Fatalf("expected a record per tool call, got %d", len(records))
+	}
+	var summary []string
+	for _, rec := range records {
+		summary = append(summary, rec.Server+"/"+rec.Tool+"="+rec.Status)
+		if rec.Caller != "limited" || rec.RequestID == "" {
+			t.Errorf("expected caller limited and a request ID, got %+v", rec)
+		}
+	}
+	if got := strings.Join(summary, ","); got != "a/search_issues=ok,/delete_issue=rejected,/missing=error" {
+		t.Errorf("unexpected records %s", got)
+	}
+}
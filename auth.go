@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// Authenticator verifies the credentials of incoming requests
+type Authenticator struct {
+	apiKeys     map[[sha256.Size]byte]*APIKeyConfig
+	jwt         *jwtValidator
+	clientCerts []ClientCertConfig
+	logger      *slog.Logger
+}
+
+// NewAuthenticator creates an authenticator from the auth config
+func NewAuthenticator(cfg *AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		apiKeys: make(map[[sha256.Size]byte]*APIKeyConfig),
+		logger:  WithComponent("auth"),
+	}
+
+	for i := range cfg.APIKeys {
+		keyCfg := &cfg.APIKeys[i]
+		if keyCfg.Name == "" {
+			return nil, fmt.Errorf("api key #%d has no name", i+1)
+		}
+		for _, pattern := range keyCfg.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("api key %s has invalid tool pattern %q: %w", keyCfg.Name, pattern, err)
+			}
+		}
+
+		key, err := loadAPIKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load api key %s: %w", keyCfg.Name, err)
+		}
+
+		hash := sha256.Sum256([]byte(key))
+		if _, exists := a.apiKeys[hash]; exists {
+			return nil, fmt.Errorf("api key %s is a duplicate of another key", keyCfg.Name)
+		}
+		a.apiKeys[hash] = keyCfg
+	}
+
+	for i, certCfg := range cfg.ClientCerts {
+		if certCfg.Subject == "" {
+			return nil, fmt.Errorf("client cert #%d has no subject", i+1)
+		}
+		for _, pattern := range certCfg.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("client cert %s has invalid tool pattern %q: %w", certCfg.Subject, pattern, err)
+			}
+		}
+	}
+	a.clientCerts = cfg.ClientCerts
+
+	if cfg.JWT != nil {
+		validator, err := newJWTValidator(cfg.JWT, a.logger)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwt config: %w", err)
+		}
+		a.jwt = validator
+	}
+
+	return a, nil
+}
+
+// loadAPIKey reads the key value from wherever the config says it is
+func loadAPIKey(cfg *APIKeyConfig) (string, error) {
+	var key string
+	switch {
+	case cfg.Key != "":
+		key = cfg.Key
+	case cfg.KeyFile != "":
+		buf, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return "", err
+		}
+		key = string(buf)
+	case cfg.KeyEnv != "":
+		key = os.Getenv(cfg.KeyEnv)
+	}
+
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", fmt.Errorf("key is empty")
+	}
+	return key, nil
+}
+
+// Authenticate identifies the caller of the request. It fails with 401 if
+// the request carries no valid credentials.
+func (a *Authenticator) Authenticate(r *http.Request) (*Caller, error) {
+	key := r.Header.Get(apiKeyHeader)
+	if key == "" {
+		token := bearerToken(r)
+		if a.jwt != nil && isJWT(token) {
+			caller, err := a.jwt.validate(r.Context(), token)
+			if err != nil {
+				a.logger.WarnContext(r.Context(), "Rejected request with invalid JWT", "remote_addr", r.RemoteAddr, "error", err)
+				return nil, &httpError{status: http.StatusUnauthorized, message: "Invalid credentials"}
+			}
+			return caller, nil
+		}
+		key = token
+	}
+	if key == "" {
+		if caller := a.authenticateClientCert(r); caller != nil {
+			return caller, nil
+		}
+		return nil, &httpError{status: http.StatusUnauthorized, message: "Missing credentials"}
+	}
+
+	// Keys are looked up by hash so that the lookup does not depend on the key contents
+	keyCfg, ok := a.apiKeys[sha256.Sum256([]byte(key))]
+	if !ok {
+		a.logger.WarnContext(r.Context(), "Rejected request with unknown API key", "remote_addr", r.RemoteAddr)
+		return nil, &httpError{status: http.StatusUnauthorized, message: "Invalid credentials"}
+	}
+
+	return &Caller{
+		ID:         keyCfg.Name,
+		restricted: true,
+		scopes:     []AccessScope{keyCfg.AccessScope},
+	}, nil
+}
+
+// credentialHeader returns the name of the header that carries the
+// credentials Authenticate checks, or "" if there is none
+func (a *Authenticator) credentialHeader(r *http.Request) string {
+	switch {
+	case r.Header.Get(apiKeyHeader) != "":
+		return apiKeyHeader
+	case bearerToken(r) != "":
+		return "Authorization"
+	}
+	return ""
+}
+
+// authenticateClientCert returns the caller identified by the verified client
+// certificate, if its subject is listed in the config
+func (a *Authenticator) authenticateClientCert(r *http.Request) *Caller {
+	cert := verifiedClientCert(r)
+	if cert == nil {
+		return nil
+	}
+
+	caller := callerFromClientCert(r)
+	caller.restricted = true
+	for _, certCfg := range a.clientCerts {
+		if certCfg.Subject == cert.Subject.CommonName || certCfg.Subject == cert.Subject.String() {
+			caller.scopes = append(caller.scopes, certCfg.AccessScope)
+		}
+	}
+	if len(caller.scopes) == 0 {
+		a.logger.WarnContext(r.Context(), "Rejected client certificate not listed in the config",
+			"subject", cert.Subject.String(),
+			"remote_addr", r.RemoteAddr)
+		return nil
+	}
+	return caller
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+func TestNewAuthenticator(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("file-key\n"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	t.Setenv("TEST_PROXY_API_KEY", "env-key")
+
+	tests := []struct {
+		name    string
+		keys    []APIKeyConfig
+		wantErr bool
+	}{
+		{
+			name: "Keys from config, file and env",
+			keys: []APIKeyConfig{
+				{Name: "inline", Key: "inline-key"},
+				{Name: "file", KeyFile: keyFile},
+				{Name: "env", KeyEnv: "TEST_PROXY_API_KEY"},
+			},
+		},
+		{
+			name:    "Missing name",
+			keys:    []APIKeyConfig{{Key: "inline-key"}},
+			wantErr: true,
+		},
+		{
+			name:    "Empty key",
+			keys:    []APIKeyConfig{{Name: "empty", KeyEnv: "TEST_PROXY_UNSET_KEY"}},
+			wantErr: true,
+		},
+		{
+			name:    "Missing key file",
+			keys:    []APIKeyConfig{{Name: "file", KeyFile: filepath.Join(t.TempDir(), "missing")}},
+			wantErr: true,
+		},
+		{
+			name: "Duplicate keys",
+			keys: []APIKeyConfig{
+				{Name: "first", Key: "same-key"},
+				{Name: "second", Key: "same-key"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid tool pattern",
+			keys: []APIKeyConfig{
+				{Name: "bad", Key: "key", AccessScope: AccessScope{Tools: []string{"[invalid"}}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAuthenticator(&AuthConfig{APIKeys: tt.keys})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticatorClientCerts(t *testing.T) {
+	tests := []struct {
+		name    string
+		certs   []ClientCertConfig
+		wantErr bool
+	}{
+		{name: "Valid", certs: []ClientCertConfig{{Subject: "billing-service"}}},
+		{name: "Missing subject", certs: []ClientCertConfig{{AccessScope: AccessScope{Servers: []string{"a"}}}}, wantErr: true},
+		{name: "Invalid tool pattern", certs: []ClientCertConfig{{Subject: "bot", AccessScope: AccessScope{Tools: []string{"[invalid"}}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAuthenticator(&AuthConfig{ClientCerts: tt.certs})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	auth, err := NewAuthenticator(&AuthConfig{APIKeys: []APIKeyConfig{
+		{Name: "ci-bot", Key: "secret-key", AccessScope: AccessScope{Servers: []string{"github"}}},
+	}})
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		expectedID string
+		status     int
+	}{
+		{
+			name:       "API key header",
+			headers:    map[string]string{"X-API-Key": "secret-key"},
+			expectedID: "ci-bot",
+		},
+		{
+			name:       "Bearer token",
+			headers:    map[string]string{"Authorization": "Bearer secret-key"},
+			expectedID: "ci-bot",
+		},
+		{
+			name:   "Missing credentials",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:    "Unknown key",
+			headers: map[string]string{"X-API-Key": "wrong-key"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "Basic auth is not accepted",
+			headers: map[string]string{"Authorization": "Basic c2VjcmV0LWtleQ=="},
+			status:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			caller, err := auth.Authenticate(req)
+			if tt.status != 0 {
+				httpErr, ok := err.(*httpError)
+				if !ok || httpErr.status != tt.status {
+					t.Fatalf("expected HTTP error %d, got %v", tt.status, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate failed: %v", err)
+			}
+			if caller.ID != tt.expectedID {
+				t.Errorf("expected caller %s, got %s", tt.expectedID, caller.ID)
+			}
+			if caller.allowsServer("jira") {
+				t.Error("caller should be limited to the scope of its key")
+			}
+		})
+	}
+}
+
+// newScopedTestServer returns a server with two upstreams and an API key limited to
+// the search_* tools of server "a"
+func newScopedTestServer(t *testing.T, splitMode bool) *Server {
+	t.Helper()
+
+	tool := func(name string) mcpserver.ServerTool {
+		return mcpserver.ServerTool{
+			Tool: mcp.NewTool(name),
+			Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return mcp.NewToolResultText("called " + name), nil
+			},
+		}
+	}
+	clients := map[string]*MCPClient{
+		"a": newInProcessMCPClient(t, &MCPClientConfig{}, tool("search_issues"), tool("delete_issue")),
+		"b": newInProcessMCPClient(t, &MCPClientConfig{}, tool("search_docs")),
+	}
+
+	auth, err := NewAuthenticator(&AuthConfig{APIKeys: []APIKeyConfig{
+		{Name: "limited", Key: "limited-key", AccessScope: AccessScope{Servers: []string{"a"}, Tools: []string{"search_*"}}},
+	}})
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	return NewServer(clients, splitMode, WithAuthenticator(auth))
+}
+
+func doJSONRPC(t *testing.T, server *Server, path, key, body string) (*httptest.ResponseRecorder, JSONRPCResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	server.handleJSONRPC(w, req)
+
+	var resp JSONRPCResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w, resp
+}
+
+func TestAPIKeyScopesFlatMode(t *testing.T) {
+	server := newScopedTestServer(t, false)
+
+	// Requests without a key are rejected
+	w, _ := doJSONRPC(t, server, "/", "", `{"jsonrpc":"2.0","method":"tools/list","id":1}`)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without API key, got %d", w.Code)
+	}
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Error("expected WWW-Authenticate header on 401")
+	}
+
+	// tools/list only returns the tools the key may call
+	_, resp := doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/list","id":1}`)
+	result, _ := json.Marshal(resp.Result)
+	var list mcp.ListToolsResult
+	if err := json.Unmarshal(result, &list); err != nil {
+		t.Fatalf("Failed to parse tools/list result: %v", err)
+	}
+	var names []string
+	for _, tool := range list.Tools {
+		names = append(names, tool.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "search_issues" {
+		t.Errorf("expected only search_issues, got %v", names)
+	}
+
+	// Calls outside the scope are rejected
+	_, resp = doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"delete_issue"},"id":2}`)
+	if resp.Error == nil || resp.Error.Code != errCodeForbidden {
+		t.Errorf("expected forbidden error, got %+v", resp)
+	}
+
+	_, resp = doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"search_issues"},"id":3}`)
+	if resp.Error != nil {
+		t.Errorf("expected allowed tool call to succeed, got %+v", resp.Error)
+	}
+}
+
+func TestAPIKeyScopesSplitMode(t *testing.T) {
+	server := newScopedTestServer(t, true)
+
+	w, _ := doJSONRPC(t, server, "/b", "limited-key", `{"jsonrpc":"2.0","method":"tools/list","id":1}`)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for server outside the scope, got %d", w.Code)
+	}
+
+	_, resp := doJSONRPC(t, server, "/a", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"delete_issue"},"id":2}`)
+	if resp.Error == nil || resp.Error.Code != errCodeForbidden {
+		t.Errorf("expected forbidden error, got %+v", resp)
+	}
+
+	_, resp = doJSONRPC(t, server, "/a", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"search_issues"},"id":3}`)
+	if resp.Error != nil {
+		t.Errorf("expected allowed tool call to succeed, got %+v", resp.Error)
+	}
+}
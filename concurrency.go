@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const defaultQueueTimeout = 30 * time.Second
+
+// concurrencyLimiter bounds the number of in-flight tool calls to a server.
+// Calls over the limit wait in a bounded queue until a slot frees up or the queue timeout expires.
+type concurrencyLimiter struct {
+	slots        chan struct{}
+	queueSize    int
+	queueTimeout time.Duration
+	logger       *slog.Logger
+
+	mu      sync.Mutex
+	waiting int
+}
+
+// newConcurrencyLimiter creates a limiter, or returns nil if maxConcurrent is not configured
+func newConcurrencyLimiter(ext *Extensions, logger *slog.Logger) *concurrencyLimiter {
+	if ext == nil || ext.MaxConcurrent <= 0 {
+		return nil
+	}
+
+	queueTimeout := time.Duration(ext.QueueTimeout)
+	if queueTimeout <= 0 {
+		queueTimeout = defaultQueueTimeout
+	}
+
+	return &concurrencyLimiter{
+		slots:        make(chan struct{}, ext.MaxConcurrent),
+		queueSize:    ext.QueueSize,
+		queueTimeout: queueTimeout,
+		logger:       logger,
+	}
+}
+
+// acquire takes a slot, waiting in the queue if necessary.
+// The returned function must be called to release the slot.
+func (l *concurrencyLimiter) acquire(ctx context.Context, toolName string) (func(), error) {
+	release := func() { <-l.slots }
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	l.mu.Lock()
+	if l.waiting >= l.queueSize {
+		depth := l.waiting
+		l.mu.Unlock()
+		l.logger.WarnContext(ctx, "Tool call rejected, queue is full",
+			"tool", toolName,
+			"queue_depth", depth,
+			"max_concurrent", cap(l.slots))
+		return nil, newServerBusyError("queue full", depth, cap(l.slots))
+	}
+	l.waiting++
+	depth := l.waiting
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	l.logger.InfoContext(ctx, "Tool call queued", "tool", toolName, "queue_depth", depth)
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		l.logger.WarnContext(ctx, "Tool call timed out in queue",
+			"tool", toolName,
+			"queue_timeout", l.queueTimeout.String())
+		return nil, newServerBusyError("queue timeout", depth, cap(l.slots))
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// queueDepth returns the number of calls waiting for a slot
+func (l *concurrencyLimiter) queueDepth() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.waiting
+}
+
+// newServerBusyError creates the JSON-RPC error returned when a call cannot get a slot
+func newServerBusyError(reason string, queueDepth, maxConcurrent int) *rpcError {
+	return &rpcError{
+		code:    errCodeServerBusy,
+		message: "Server busy",
+		data: map[string]interface{}{
+			"reason":        reason,
+			"queueDepth":    queueDepth,
+			"maxConcurrent": maxConcurrent,
+		},
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewConcurrencyLimiterDisabled(t *testing.T) {
+	if l := newConcurrencyLimiter(nil, WithComponent("test")); l != nil {
+		t.Error("limiter should be disabled without extensions")
+	}
+	if l := newConcurrencyLimiter(&Extensions{}, WithComponent("test")); l != nil {
+		t.Error("limiter should be disabled when maxConcurrent is 0")
+	}
+}
+
+func TestConcurrencyLimiterQueueFull(t *testing.T) {
+	l := newConcurrencyLimiter(&Extensions{MaxConcurrent: 1}, WithComponent("test"))
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx, "tool")
+	if err != nil {
+		t.Fatalf("first call should get a slot: %v", err)
+	}
+	defer release()
+
+	// No queue configured, so the second call is rejected right away
+	_, err = l.acquire(ctx, "tool")
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) || rpcErr.code != errCodeServerBusy {
+		t.Fatalf("expected server busy error, got %v", err)
+	}
+	if reason := rpcErr.data.(map[string]interface{})["reason"]; reason != "queue full" {
+		t.Errorf("expected reason 'queue full', got %v", reason)
+	}
+}
+
+func TestConcurrencyLimiterQueueing(t *testing.T) {
+	l := newConcurrencyLimiter(&Extensions{
+		MaxConcurrent: 1,
+		QueueSize:     1,
+		QueueTimeout:  Duration(time.Second),
+	}, WithComponent("test"))
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx, "tool")
+	if err != nil {
+		t.Fatalf("first call should get a slot: %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		release2, err := l.acquire(ctx, "tool")
+		if err == nil {
+			release2()
+		}
+		acquired <- err
+	}()
+
+	// Wait until the second call is queued
+	deadline := time.Now().Add(time.Second)
+	for l.queueDepth() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second call was not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queue is full now
+	if _, err := l.acquire(ctx, "tool"); err == nil {
+		t.Error("third call should be rejected while the queue is full")
+	}
+
+	release()
+	if err := <-acquired; err != nil {
+		t.Errorf("queued call should get the released slot: %v", err)
+	}
+}
+
+func TestConcurrencyLimiterQueueTimeout(t *testing.T) {
+	l := newConcurrencyLimiter(&Extensions{
+		MaxConcurrent: 1,
+		QueueSize:     5,
+		QueueTimeout:  Duration(10 * time.Millisecond),
+	}, WithComponent("test"))
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx, "tool")
+	if err != nil {
+		t.Fatalf("first call should get a slot: %v", err)
+	}
+	defer release()
+
+	_, err = l.acquire(ctx, "tool")
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) || rpcErr.code != errCodeServerBusy {
+		t.Fatalf("expected server busy error, got %v", err)
+	}
+	if reason := rpcErr.data.(map[string]interface{})["reason"]; reason != "queue timeout" {
+		t.Errorf("expected reason 'queue timeout', got %v", reason)
+	}
+	if depth := l.queueDepth(); depth != 0 {
+		t.Errorf("timed out call should leave the queue, depth is %d", depth)
+	}
+}
@@ -8,14 +8,174 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Duration is a time.Duration that is written as a string like "30s" in config files.
+// Plain numbers are interpreted as seconds.
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration from a JSON string or number
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration: %s", string(b))
+	}
+	return nil
+}
+
+// UnmarshalYAML parses a duration from a YAML scalar
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var seconds float64
+	if err := value.Decode(&seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", value.Value, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
 // ToolsExtensions contains tool allow/deny lists
 type ToolsExtensions struct {
 	Allow []string `yaml:"allow" json:"allow"`
 	Deny  []string `yaml:"deny" json:"deny"`
+
+	// Tools whose calls are held until an approver approves them
+	RequireApproval []string `yaml:"requireApproval" json:"requireApproval"`
+}
+
+// RetryExtensions contains the retry policy for failed tool calls.
+// Only idempotent tools are retried.
+type RetryExtensions struct {
+	// Maximum number of attempts including the first one (default: 3)
+	MaxAttempts int `yaml:"maxAttempts" json:"maxAttempts"`
+
+	// Backoff before the first retry, doubled on each further retry (default: 200ms)
+	InitialBackoff Duration `yaml:"initialBackoff" json:"initialBackoff"`
+
+	// Upper bound of the backoff (default: 5s)
+	MaxBackoff Duration `yaml:"maxBackoff" json:"maxBackoff"`
+
+	// Tools that are safe to retry in addition to the ones the server
+	// annotates as idempotent or read-only
+	Tools []string `yaml:"tools" json:"tools"`
+}
+
+// CircuitBreakerExtensions contains circuit breaker settings
+type CircuitBreakerExtensions struct {
+	// Number of consecutive failures that opens the circuit. 0 disables the breaker.
+	FailureThreshold int `yaml:"failureThreshold" json:"failureThreshold"`
+
+	// How long the circuit stays open before probe requests are let through (default: 30s)
+	OpenTimeout Duration `yaml:"openTimeout" json:"openTimeout"`
+
+	// Number of concurrent probe requests allowed while half-open (default: 1)
+	HalfOpenRequests int `yaml:"halfOpenRequests" json:"halfOpenRequests"`
+}
+
+// ForwardExtensions controls what the proxy passes on about the downstream caller
+type ForwardExtensions struct {
+	// Downstream request headers forwarded to SSE / Streamable HTTP servers
+	Headers []string `yaml:"headers" json:"headers"`
+
+	// If true, the caller identity is sent in the _meta of tool calls
+	Identity bool `yaml:"identity" json:"identity"`
+}
+
+// RateLimit is a token bucket that allows Requests calls per Period on
+// average, with bursts of up to Burst calls
+type RateLimit struct {
+	Requests int `yaml:"requests" json:"requests"`
+
+	// Period over which Requests are allowed (default: 1s)
+	Period Duration `yaml:"period" json:"period"`
+
+	// Maximum number of calls at once (default: Requests)
+	Burst int `yaml:"burst" json:"burst"`
+}
+
+// RateLimitExtensions contains the rate limits of tool calls to one server
+type RateLimitExtensions struct {
+	// Limit for all calls to the server
+	Server *RateLimit `yaml:"server" json:"server"`
+
+	// Limit for each listed tool
+	Tools map[string]RateLimit `yaml:"tools" json:"tools"`
+}
+
+// StderrExtensions controls how the stderr of a stdio server is logged
+type StderrExtensions struct {
+	// How the severity of each line is found: "plain" (default; every line is
+	// a warning), "json" (a level or severity field), "text" (level=... or a
+	// leading INFO, [warn] or ERROR:) or "auto" (json, then text)
+	Format string `yaml:"format" json:"format"`
+
+	// Number of recent lines kept for the admin API (default: 100)
+	BufferLines int `yaml:"bufferLines" json:"bufferLines"`
+}
+
+// OutputFilter masks or drops parts of tool results before they are returned
+// to the caller
+type OutputFilter struct {
+	// Regular expressions; matches in text content are masked
+	Patterns []string `yaml:"patterns" json:"patterns"`
+
+	// Built-in detectors whose matches are masked: email, phone, creditCard
+	Detectors []string `yaml:"detectors" json:"detectors"`
+
+	// Content to drop, by content type like "image" or by MIME type like
+	// "application/pdf" or "image/*"
+	DropContent []string `yaml:"dropContent" json:"dropContent"`
+
+	// Text that replaces masked matches (default: [FILTERED])
+	Mask string `yaml:"mask" json:"mask"`
+}
+
+// OutputFilterExtensions contains the output filters of one server. Tool
+// filters run after the server filter.
+type OutputFilterExtensions struct {
+	// Filter for the results of all tools of the server
+	Server *OutputFilter `yaml:"server" json:"server"`
+
+	// Filters for the results of single tools, by tool name
+	Tools map[string]OutputFilter `yaml:"tools" json:"tools"`
+}
+
+// ResultLimit is the maximum size of tool results
+type ResultLimit struct {
+	// Maximum size of the result content in bytes
+	MaxBytes int `yaml:"maxBytes" json:"maxBytes"`
+
+	// What to do with larger results: "truncate" (default) cuts the text
+	// content and adds a marker, "error" returns an isError result instead
+	Action string `yaml:"action" json:"action"`
+}
+
+// ResultLimitExtensions contains the result size limits of one server
+type ResultLimitExtensions struct {
+	// Limit for the results of all tools of the server
+	Server *ResultLimit `yaml:"server" json:"server"`
+
+	// Limits for the results of single tools, by tool name. They replace the server limit.
+	Tools map[string]ResultLimit `yaml:"tools" json:"tools"`
 }
 
 // Extensions contains various extension configurations
@@ -27,6 +187,39 @@ type Extensions struct {
 	Sse bool `yaml:"sse" json:"sse"`
 
 	Tools ToolsExtensions `yaml:"tools" json:"tools"`
+
+	// Timeout for each request to the server (default: 60s)
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+
+	Retry          *RetryExtensions          `yaml:"retry" json:"retry"`
+	CircuitBreaker *CircuitBreakerExtensions `yaml:"circuitBreaker" json:"circuitBreaker"`
+
+	// Maximum number of concurrent tool calls to the server. 0 means unlimited.
+	MaxConcurrent int `yaml:"maxConcurrent" json:"maxConcurrent"`
+
+	// Number of calls that may wait for a free slot before the server is reported busy
+	QueueSize int `yaml:"queueSize" json:"queueSize"`
+
+	// How long a call may wait in the queue (default: 30s)
+	QueueTimeout Duration `yaml:"queueTimeout" json:"queueTimeout"`
+
+	Forward *ForwardExtensions `yaml:"forward" json:"forward"`
+
+	RateLimit *RateLimitExtensions `yaml:"rateLimit" json:"rateLimit"`
+
+	OutputFilter *OutputFilterExtensions `yaml:"outputFilter" json:"outputFilter"`
+
+	ResultLimit *ResultLimitExtensions `yaml:"resultLimit" json:"resultLimit"`
+
+	Stderr *StderrExtensions `yaml:"stderr" json:"stderr"`
+}
+
+// OAuthConfig contains the OAuth 2.0 client credentials used to get access tokens for a remote server
+type OAuthConfig struct {
+	TokenURL     string   `yaml:"tokenUrl" json:"tokenUrl"`
+	ClientID     string   `yaml:"clientId" json:"clientId"`
+	ClientSecret string   `yaml:"clientSecret" json:"clientSecret"`
+	Scopes       []string `yaml:"scopes" json:"scopes"`
 }
 
 // ServerConfig represents the MCP server configuration structure
@@ -35,23 +228,276 @@ type ServerConfig struct {
 	Args       []string          `yaml:"args" json:"args"`
 	Env        map[string]string `yaml:"env" json:"env"`
 	Url        string            `yaml:"url" json:"url"`
+	Headers    map[string]string `yaml:"headers" json:"headers"`
+	OAuth      *OAuthConfig      `yaml:"oauth" json:"oauth"`
 	Extensions *Extensions       `yaml:"_extensions" json:"_extensions"`
 }
 
+// AccessScope limits the servers and tools a caller may use
+type AccessScope struct {
+	// Server names. Empty means all servers.
+	Servers []string `yaml:"servers" json:"servers"`
+
+	// Tool name patterns such as "search_*". Empty means all tools.
+	Tools []string `yaml:"tools" json:"tools"`
+}
+
+// APIKeyConfig defines an API key accepted by the proxy. The key is given
+// directly, read from a file or read from an environment variable.
+type APIKeyConfig struct {
+	Name        string `yaml:"name" json:"name"`
+	Key         string `yaml:"key" json:"key"`
+	KeyFile     string `yaml:"keyFile" json:"keyFile"`
+	KeyEnv      string `yaml:"keyEnv" json:"keyEnv"`
+	AccessScope `yaml:",inline"`
+}
+
+// JWTConfig contains the settings for validating JWT bearer tokens issued by an OIDC provider
+type JWTConfig struct {
+	// Where to get the signing keys: a JWKS URL or a local JWKS file
+	JWKSURL  string `yaml:"jwksUrl" json:"jwksUrl"`
+	JWKSFile string `yaml:"jwksFile" json:"jwksFile"`
+
+	// Expected "iss" and "aud" claims
+	Issuer   string `yaml:"issuer" json:"issuer"`
+	Audience string `yaml:"audience" json:"audience"`
+
+	// Claim used as the caller identity (default: sub)
+	SubjectClaim string `yaml:"subjectClaim" json:"subjectClaim"`
+
+	// Claim that holds the caller's groups (default: groups)
+	GroupsClaim string `yaml:"groupsClaim" json:"groupsClaim"`
+
+	// Access scope of each group. If set, callers may only use what the
+	// scopes of their groups allow. If empty, any valid token has full access.
+	Groups map[string]AccessScope `yaml:"groups" json:"groups"`
+}
+
+// ClientCertConfig defines the access scope of clients presenting a verified
+// TLS certificate with the given subject
+type ClientCertConfig struct {
+	// Common name or full distinguished name of the certificate subject
+	Subject     string `yaml:"subject" json:"subject"`
+	AccessScope `yaml:",inline"`
+}
+
+// AuthConfig contains the authentication settings for incoming requests
+type AuthConfig struct {
+	APIKeys     []APIKeyConfig     `yaml:"apiKeys" json:"apiKeys"`
+	JWT         *JWTConfig         `yaml:"jwt" json:"jwt"`
+	ClientCerts []ClientCertConfig `yaml:"clientCerts" json:"clientCerts"`
+}
+
+// RateLimitConfig contains the proxy-wide rate limits of tool calls
+type RateLimitConfig struct {
+	// Limit for all calls together
+	Global *RateLimit `yaml:"global" json:"global"`
+
+	// Limit for each caller identity, or each client IP for unidentified callers
+	PerCaller *RateLimit `yaml:"perCaller" json:"perCaller"`
+}
+
+// ApprovalConfig contains the settings of the approval workflow for tools
+// listed in _extensions.tools.requireApproval
+type ApprovalConfig struct {
+	// How long a call waits for a decision before it is rejected (default: 5m)
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+
+	// Bearer token approvers use on the /approvals endpoints, given directly
+	// or read from an environment variable
+	Token    string `yaml:"token" json:"token"`
+	TokenEnv string `yaml:"tokenEnv" json:"tokenEnv"`
+
+	// URL notified of each pending call, and headers sent with the notification
+	WebhookURL     string            `yaml:"webhookUrl" json:"webhookUrl"`
+	WebhookHeaders map[string]string `yaml:"webhookHeaders" json:"webhookHeaders"`
+
+	// Externally reachable base URL of the proxy, used to build the callback URL
+	// sent to the webhook
+	CallbackBaseURL string `yaml:"callbackBaseUrl" json:"callbackBaseUrl"`
+}
+
+// AdminConfig contains the settings of the admin API
+type AdminConfig struct {
+	// Address of the admin API listener (default: 127.0.0.1:9091)
+	Listen string `yaml:"listen" json:"listen"`
+
+	// Bearer token operators use on the /admin endpoints, given directly or
+	// read from an environment variable
+	Token    string `yaml:"token" json:"token"`
+	TokenEnv string `yaml:"tokenEnv" json:"tokenEnv"`
+
+	// Number of recent tool calls shown on the status page (default: 50)
+	RecentCalls int `yaml:"recentCalls" json:"recentCalls"`
+}
+
+// HealthConfig contains the readiness policy and the active health checks of
+// the MCP servers
+type HealthConfig struct {
+	// Readiness policy: "any" (default) is ready with one running server,
+	// "all" with all enabled servers, "required" with the servers in
+	// requiredServers and "minimum" with at least minServers
+	Readiness       string   `yaml:"readiness" json:"readiness"`
+	RequiredServers []string `yaml:"requiredServers" json:"requiredServers"`
+	MinServers      int      `yaml:"minServers" json:"minServers"`
+
+	// Interval of the pings sent to each server; no pings are sent if unset
+	Interval Duration `yaml:"interval" json:"interval"`
+
+	// Timeout of a ping (default: 5s)
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+
+	// Consecutive failed pings after which a server is unhealthy (default: 3)
+	FailureThreshold int `yaml:"failureThreshold" json:"failureThreshold"`
+
+	// Reconnect unhealthy servers, e.g. to replace dead HTTP sessions
+	Reconnect bool `yaml:"reconnect" json:"reconnect"`
+}
+
+// LoggingConfig contains the log output settings. Command line flags take
+// precedence over it.
+type LoggingConfig struct {
+	// Format: "json" (default) or "text"
+	Format string `yaml:"format" json:"format"`
+
+	// Level: "debug", "info" (default), "warn" or "error"
+	Level string `yaml:"level" json:"level"`
+
+	// Level overrides by component, like {"mcp_client": "debug"}
+	Components map[string]string `yaml:"components" json:"components"`
+
+	// File to write logs to instead of stdout, rotated when it grows beyond
+	// maxSizeMb (default: 100) keeping maxBackups old files (default: 5)
+	File       string `yaml:"file" json:"file"`
+	MaxSizeMB  int    `yaml:"maxSizeMb" json:"maxSizeMb"`
+	MaxBackups int    `yaml:"maxBackups" json:"maxBackups"`
+}
+
+// TracingConfig contains the OpenTelemetry trace export settings
+type TracingConfig struct {
+	// Exporter: "otlp" (default), "stdout" or "file"
+	Exporter string `yaml:"exporter" json:"exporter"`
+
+	// OTLP/HTTP endpoint like "otel-collector:4318". The OTEL_EXPORTER_OTLP_*
+	// environment variables apply to unset OTLP options.
+	Endpoint string            `yaml:"endpoint" json:"endpoint"`
+	Insecure bool              `yaml:"insecure" json:"insecure"`
+	Headers  map[string]string `yaml:"headers" json:"headers"`
+
+	// File that the file exporter writes spans to
+	Path string `yaml:"path" json:"path"`
+
+	// Fraction of new traces to sample (default: 1). Traces continued from a
+	// traceparent header follow the sampling decision of the caller.
+	SampleRatio *float64 `yaml:"sampleRatio" json:"sampleRatio"`
+
+	// Service name of the spans (default: mcp-proxy)
+	ServiceName string `yaml:"serviceName" json:"serviceName"`
+}
+
+// RedactionConfig contains the rules for hiding secrets in the tool arguments
+// and results that the proxy logs or records
+type RedactionConfig struct {
+	// JSON paths of values to redact, like "$.auth.token" or "$.users[*].password"
+	Paths []string `yaml:"paths" json:"paths"`
+
+	// Names of keys whose values are redacted wherever they appear, as
+	// case-insensitive glob patterns like "*token*"
+	Keys []string `yaml:"keys" json:"keys"`
+
+	// Regular expressions matched against string values; matches are redacted
+	Patterns []string `yaml:"patterns" json:"patterns"`
+
+	// Text that replaces redacted values (default: [REDACTED])
+	Replacement string `yaml:"replacement" json:"replacement"`
+}
+
+// AuditConfig contains the settings of the audit log of tool calls
+type AuditConfig struct {
+	// Where records are written: "file" or "stdout"
+	Sink string `yaml:"sink" json:"sink"`
+
+	// Path of the JSONL file for the file sink
+	Path string `yaml:"path" json:"path"`
+
+	// The file is rotated when it grows beyond this many megabytes (default: 100)
+	MaxSizeMB int `yaml:"maxSizeMb" json:"maxSizeMb"`
+
+	// Number of rotated files to keep (default: 5)
+	MaxBackups int `yaml:"maxBackups" json:"maxBackups"`
+
+	// Record the arguments themselves, not only their hash
+	IncludeArguments bool `yaml:"includeArguments" json:"includeArguments"`
+}
+
+// PolicyRule allows or denies the tool calls matching a CEL expression
+type PolicyRule struct {
+	Name string `yaml:"name" json:"name"`
+
+	// CEL expression over caller, server, tool and args that must evaluate to a bool
+	Match string `yaml:"match" json:"match"`
+
+	// "allow" or "deny"
+	Effect string `yaml:"effect" json:"effect"`
+
+	// Reason returned to the client when the rule denies a call
+	Message string `yaml:"message" json:"message"`
+}
+
+// PolicyConfig contains the rules that authorize tool calls. The first
+// matching rule decides.
+type PolicyConfig struct {
+	// Effect when no rule matches: "allow" (default) or "deny"
+	Default string       `yaml:"default" json:"default"`
+	Rules   []PolicyRule `yaml:"rules" json:"rules"`
+}
+
 // Config represents the application's global configuration structure
 type Config struct {
 	MCPServers map[string]ServerConfig `yaml:"mcpServers" json:"mcpServers"`
+
+	// Request header that carries the caller identity, set by a trusted
+	// authenticating proxy in front of mcp-proxy
+	IdentityHeader string `yaml:"identityHeader" json:"identityHeader"`
+
+	// Maximum size of request bodies in bytes (default: 10 MiB)
+	MaxRequestBytes int64 `yaml:"maxRequestBytes" json:"maxRequestBytes"`
+
+	Auth *AuthConfig `yaml:"auth" json:"auth"`
+
+	Policy *PolicyConfig `yaml:"policy" json:"policy"`
+
+	Approval *ApprovalConfig `yaml:"approval" json:"approval"`
+
+	RateLimits *RateLimitConfig `yaml:"rateLimits" json:"rateLimits"`
+
+	Audit *AuditConfig `yaml:"audit" json:"audit"`
+
+	Redaction *RedactionConfig `yaml:"redaction" json:"redaction"`
+
+	Tracing *TracingConfig `yaml:"tracing" json:"tracing"`
+
+	Admin *AdminConfig `yaml:"admin" json:"admin"`
+
+	Logging *LoggingConfig `yaml:"logging" json:"logging"`
+
+	Health *HealthConfig `yaml:"health" json:"health"`
 }
 
 // MCPClientConfig is the configuration used in NewMCPClient
 type MCPClientConfig struct {
+	// Name of the server in the config, used to tag logs
+	Name string `yaml:"-" json:"-"`
+
 	// Configs for stdio
 	Command string            `yaml:"command" json:"command"`
 	Args    []string          `yaml:"args" json:"args"`
 	Env     map[string]string `yaml:"env" json:"env"`
 
 	// Configs for SSE / Streamable HTTP
-	Url string `yaml:"url" json:"url"`
+	Url     string            `yaml:"url" json:"url"`
+	Headers map[string]string `yaml:"headers" json:"headers"`
+	OAuth   *OAuthConfig      `yaml:"oauth" json:"oauth"`
 
 	// Extensions
 	Extensions *Extensions `yaml:"_extensions" json:"_extensions"`
@@ -100,10 +546,23 @@ func ConvertToMCPClientConfig(serverCfg ServerConfig) *MCPClientConfig {
 		Args:       serverCfg.Args,
 		Env:        serverCfg.Env,
 		Url:        serverCfg.Url,
+		Headers:    serverCfg.Headers,
+		OAuth:      serverCfg.OAuth,
 		Extensions: serverCfg.Extensions,
 	}
 }
 
+// MCPClientConfigs returns the client configs of all servers in the config by name
+func MCPClientConfigs(cfg *Config) map[string]*MCPClientConfig {
+	configs := make(map[string]*MCPClientConfig, len(cfg.MCPServers))
+	for name, serverCfg := range cfg.MCPServers {
+		mcpCfg := ConvertToMCPClientConfig(serverCfg)
+		mcpCfg.Name = name
+		configs[name] = mcpCfg
+	}
+	return configs
+}
+
 // LogSafeEnvChecksum calculates the SHA-256 checksum of environment variable values
 // without exposing the actual values in logs
 func LogConfig(logger *slog.Logger, serverName string, env map[string]string) {
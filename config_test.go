@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -209,6 +210,554 @@ func TestLoadConfig(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Valid YAML file with timeout, retry and circuit breaker",
+			content: `mcpServers:
+  flaky-service:
+    command: echo
+    _extensions:
+      timeout: 90s
+      retry:
+        maxAttempts: 4
+        initialBackoff: 100ms
+        tools:
+          - search
+      circuitBreaker:
+        failureThreshold: 5
+        openTimeout: 1m`,
+			extension: ".yaml",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{
+					"flaky-service": {
+						Command: "echo",
+						Extensions: &Extensions{
+							Timeout: Duration(90 * time.Second),
+							Retry: &RetryExtensions{
+								MaxAttempts:    4,
+								InitialBackoff: Duration(100 * time.Millisecond),
+								Tools:          []string{"search"},
+							},
+							CircuitBreaker: &CircuitBreakerExtensions{
+								FailureThreshold: 5,
+								OpenTimeout:      Duration(time.Minute),
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid JSON file with timeout in seconds",
+			content: `{
+				"mcpServers": {
+					"slow-service": {
+						"url": "https://example.com/mcp",
+						"_extensions": {
+							"timeout": 120
+						}
+					}
+				}
+			}`,
+			extension: ".json",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{
+					"slow-service": {
+						Url: "https://example.com/mcp",
+						Extensions: &Extensions{
+							Timeout: Duration(120 * time.Second),
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with headers",
+			content: `mcpServers:
+  remote-service:
+    url: https://example.com/mcp
+    headers:
+      Authorization: Bearer $TEST_API_TOKEN
+      X-Api-Key: ${TEST_API_KEY}`,
+			extension: ".yaml",
+			envVars: map[string]string{
+				"TEST_API_TOKEN": "secret-token",
+				"TEST_API_KEY":   "secret-key",
+			},
+			want: &Config{
+				MCPServers: map[string]ServerConfig{
+					"remote-service": {
+						Url: "https://example.com/mcp",
+						Headers: map[string]string{
+							"Authorization": "Bearer secret-token",
+							"X-Api-Key":     "secret-key",
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with OAuth",
+			content: `mcpServers:
+  oauth-service:
+    url: https://example.com/mcp
+    oauth:
+      tokenUrl: https://auth.example.com/oauth/token
+      clientId: proxy
+      clientSecret: $TEST_CLIENT_SECRET
+      scopes:
+        - mcp.read`,
+			extension: ".yaml",
+			envVars: map[string]string{
+				"TEST_CLIENT_SECRET": "client-secret",
+			},
+			want: &Config{
+				MCPServers: map[string]ServerConfig{
+					"oauth-service": {
+						Url: "https://example.com/mcp",
+						OAuth: &OAuthConfig{
+							TokenURL:     "https://auth.example.com/oauth/token",
+							ClientID:     "proxy",
+							ClientSecret: "client-secret",
+							Scopes:       []string{"mcp.read"},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with API keys",
+			content: `mcpServers:
+  test-service:
+    command: echo
+auth:
+  apiKeys:
+    - name: ci-bot
+      key: $TEST_CI_KEY
+      servers:
+        - test-service
+      tools:
+        - search_*
+    - name: admin
+      keyFile: /run/secrets/admin-key`,
+			extension: ".yaml",
+			envVars: map[string]string{
+				"TEST_CI_KEY": "ci-secret",
+			},
+			want: &Config{
+				MCPServers: map[string]ServerConfig{
+					"test-service": {Command: "echo"},
+				},
+				Auth: &AuthConfig{
+					APIKeys: []APIKeyConfig{
+						{
+							Name: "ci-bot",
+							Key:  "ci-secret",
+							AccessScope: AccessScope{
+								Servers: []string{"test-service"},
+								Tools:   []string{"search_*"},
+							},
+						},
+						{Name: "admin", KeyFile: "/run/secrets/admin-key"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid JSON file with API keys",
+			content: `{
+				"mcpServers": {},
+				"auth": {
+					"apiKeys": [
+						{"name": "ci-bot", "keyEnv": "CI_BOT_KEY", "servers": ["github"]}
+					]
+				}
+			}`,
+			extension: ".json",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{},
+				Auth: &AuthConfig{
+					APIKeys: []APIKeyConfig{
+						{Name: "ci-bot", KeyEnv: "CI_BOT_KEY", AccessScope: AccessScope{Servers: []string{"github"}}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with JWT auth",
+			content: `mcpServers: {}
+auth:
+  jwt:
+    jwksUrl: https://login.example.com/.well-known/jwks.json
+    issuer: https://login.example.com/
+    audience: mcp-proxy
+    groupsClaim: roles
+    groups:
+      developers:
+        servers:
+          - github
+      readers:
+        tools:
+          - "get_*"`,
+			extension: ".yaml",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{},
+				Auth: &AuthConfig{
+					JWT: &JWTConfig{
+						JWKSURL:     "https://login.example.com/.well-known/jwks.json",
+						Issuer:      "https://login.example.com/",
+						Audience:    "mcp-proxy",
+						GroupsClaim: "roles",
+						Groups: map[string]AccessScope{
+							"developers": {Servers: []string{"github"}},
+							"readers":    {Tools: []string{"get_*"}},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid JSON file with client certificates",
+			content: `{
+				"mcpServers": {},
+				"auth": {
+					"clientCerts": [
+						{"subject": "billing-service", "servers": ["stripe"], "tools": ["get_*"]}
+					]
+				}
+			}`,
+			extension: ".json",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{},
+				Auth: &AuthConfig{
+					ClientCerts: []ClientCertConfig{
+						{Subject: "billing-service", AccessScope: AccessScope{Servers: []string{"stripe"}, Tools: []string{"get_*"}}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with policy rules",
+			content: `mcpServers: {}
+policy:
+  default: allow
+  rules:
+    - name: oncall-restarts
+      match: 'tool.startsWith("restart_") && !("oncall" in caller.groups)'
+      effect: deny
+      message: only oncall may restart services`,
+			extension: ".yaml",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{},
+				Policy: &PolicyConfig{
+					Default: "allow",
+					Rules: []PolicyRule{
+						{
+							Name:    "oncall-restarts",
+							Match:   `tool.startsWith("restart_") && !("oncall" in caller.groups)`,
+							Effect:  "deny",
+							Message: "only oncall may restart services",
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with approvals",
+			content: `mcpServers:
+  ops:
+    command: ops-mcp
+    _extensions:
+      tools:
+        requireApproval:
+          - deploy
+approval:
+  timeout: 10m
+  tokenEnv: APPROVER_TOKEN
+  webhookUrl: https://chat.example.com/hooks/approvals
+  callbackBaseUrl: https://mcp-proxy.example.com`,
+			extension: ".yaml",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{
+					"ops": {
+						Command: "ops-mcp",
+						Extensions: &Extensions{
+							Tools: ToolsExtensions{RequireApproval: []string{"deploy"}},
+						},
+					},
+				},
+				Approval: &ApprovalConfig{
+					Timeout:         Duration(10 * time.Minute),
+					TokenEnv:        "APPROVER_TOKEN",
+					WebhookURL:      "https://chat.example.com/hooks/approvals",
+					CallbackBaseURL: "https://mcp-proxy.example.com",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with rate limits",
+			content: `mcpServers:
+  search:
+    command: search-mcp
+    _extensions:
+      rateLimit:
+        server:
+          requests: 100
+          period: 1m
+        tools:
+          deep_research:
+            requests: 5
+            period: 1h
+            burst: 2
+rateLimits:
+  global:
+    requests: 50
+  perCaller:
+    requests: 10
+    period: 1m`,
+			extension: ".yaml",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{
+					"search": {
+						Command: "search-mcp",
+						Extensions: &Extensions{
+							RateLimit: &RateLimitExtensions{
+								Server: &RateLimit{Requests: 100, Period: Duration(time.Minute)},
+								Tools: map[string]RateLimit{
+									"deep_research": {Requests: 5, Period: Duration(time.Hour), Burst: 2},
+								},
+							},
+						},
+					},
+				},
+				RateLimits: &RateLimitConfig{
+					Global:    &RateLimit{Requests: 50},
+					PerCaller: &RateLimit{Requests: 10, Period: Duration(time.Minute)},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid JSON file with audit log",
+			content: `{
+				"mcpServers": {},
+				"audit": {"sink": "file", "path": "/var/log/mcp-proxy/audit.jsonl", "maxSizeMb": 50, "maxBackups": 10}
+			}`,
+			extension: ".json",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{},
+				Audit: &AuditConfig{
+					Sink:       "file",
+					Path:       "/var/log/mcp-proxy/audit.jsonl",
+					MaxSizeMB:  50,
+					MaxBackups: 10,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with redaction",
+			content: `mcpServers: {}
+redaction:
+  paths: ["$.auth.token"]
+  keys: ["*password*"]
+  patterns: ["sk-[a-zA-Z0-9]+"]
+  replacement: "***"`,
+			extension: ".yaml",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{},
+				Redaction: &RedactionConfig{
+					Paths:       []string{"$.auth.token"},
+					Keys:        []string{"*password*"},
+					Patterns:    []string{"sk-[a-zA-Z0-9]+"},
+					Replacement: "***",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with output filters",
+			content: `mcpServers:
+  crm:
+    command: crm-mcp
+    _extensions:
+      outputFilter:
+        server:
+          detectors: [email, phone]
+          dropContent: [image]
+        tools:
+          get_customer:
+            patterns: ["CUST-\\d+"]
+            mask: "<id>"`,
+			extension: ".yaml",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{
+					"crm": {
+						Command: "crm-mcp",
+						Extensions: &Extensions{
+							OutputFilter: &OutputFilterExtensions{
+								Server: &OutputFilter{
+									Detectors:   []string{"email", "phone"},
+									DropContent: []string{"image"},
+								},
+								Tools: map[string]OutputFilter{
+									"get_customer": {Patterns: []string{`CUST-\d+`}, Mask: "<id>"},
+								},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with size limits",
+			content: `maxRequestBytes: 1048576
+mcpServers:
+  logs:
+    command: logs-mcp
+    _extensions:
+      resultLimit:
+        server:
+          maxBytes: 65536
+        tools:
+          dump:
+            maxBytes: 1024
+            action: error`,
+			extension: ".yaml",
+			want: &Config{
+				MaxRequestBytes: 1048576,
+				MCPServers: map[string]ServerConfig{
+					"logs": {
+						Command: "logs-mcp",
+						Extensions: &Extensions{
+							ResultLimit: &ResultLimitExtensions{
+								Server: &ResultLimit{MaxBytes: 65536},
+								Tools:  map[string]ResultLimit{"dump": {MaxBytes: 1024, Action: "error"}},
+							},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with tracing",
+			content: `mcpServers: {}
+tracing:
+  exporter: otlp
+  endpoint: otel-collector:4318
+  insecure: true
+  headers:
+    x-tenant: platform
+  sampleRatio: 0.25`,
+			extension: ".yaml",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{},
+				Tracing: &TracingConfig{
+					Exporter:    "otlp",
+					Endpoint:    "otel-collector:4318",
+					Insecure:    true,
+					Headers:     map[string]string{"x-tenant": "platform"},
+					SampleRatio: func() *float64 { r := 0.25; return &r }(),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with stderr parsing and admin API",
+			content: `admin:
+  listen: 0.0.0.0:9191
+  tokenEnv: MCP_PROXY_ADMIN_TOKEN
+mcpServers:
+  github:
+    command: github-mcp
+    _extensions:
+      stderr:
+        format: json
+        bufferLines: 500`,
+			extension: ".yaml",
+			want: &Config{
+				Admin: &AdminConfig{Listen: "0.0.0.0:9191", TokenEnv: "MCP_PROXY_ADMIN_TOKEN"},
+				MCPServers: map[string]ServerConfig{
+					"github": {
+						Command: "github-mcp",
+						Extensions: &Extensions{
+							Stderr: &StderrExtensions{Format: "json", BufferLines: 500},
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with logging",
+			content: `mcpServers: {}
+logging:
+  format: text
+  level: warn
+  components:
+    mcp_client: debug
+  file: /var/log/mcp-proxy.log
+  maxSizeMb: 50
+  maxBackups: 3`,
+			extension: ".yaml",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{},
+				Logging: &LoggingConfig{
+					Format:     "text",
+					Level:      "warn",
+					Components: map[string]string{"mcp_client": "debug"},
+					File:       "/var/log/mcp-proxy.log",
+					MaxSizeMB:  50,
+					MaxBackups: 3,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid YAML file with health checks",
+			content: `mcpServers: {}
+health:
+  readiness: required
+  requiredServers: [github]
+  interval: 30s
+  timeout: 2s
+  failureThreshold: 2
+  reconnect: true`,
+			extension: ".yaml",
+			want: &Config{
+				MCPServers: map[string]ServerConfig{},
+				Health: &HealthConfig{
+					Readiness:        "required",
+					RequiredServers:  []string{"github"},
+					Interval:         Duration(30 * time.Second),
+					Timeout:          Duration(2 * time.Second),
+					FailureThreshold: 2,
+					Reconnect:        true,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid duration",
+			content: `mcpServers:
+  test-service:
+    command: echo
+    _extensions:
+      timeout: soon`,
+			extension: ".yaml",
+			wantErr:   true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -330,6 +879,17 @@ func TestConvertToMCPClientConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "With URL and headers",
+			serverCfg: ServerConfig{
+				Url:     "https://example.com/mcp",
+				Headers: map[string]string{"Authorization": "Bearer token"},
+			},
+			want: &MCPClientConfig{
+				Url:     "https://example.com/mcp",
+				Headers: map[string]string{"Authorization": "Bearer token"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
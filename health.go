@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	readinessAny      = "any"
+	readinessAll      = "all"
+	readinessRequired = "required"
+	readinessMinimum  = "minimum"
+
+	defaultHealthTimeout    = 5 * time.Second
+	defaultFailureThreshold = 3
+)
+
+// HealthPolicy decides when the proxy is ready and how the servers are checked
+type HealthPolicy struct {
+	readiness        string
+	required         []string
+	minimum          int
+	interval         time.Duration
+	timeout          time.Duration
+	failureThreshold int
+	reconnect        bool
+}
+
+// NewHealthPolicy creates the health policy from the health config
+func NewHealthPolicy(cfg *HealthConfig) (*HealthPolicy, error) {
+	p := &HealthPolicy{
+		readiness:        cfg.Readiness,
+		required:         cfg.RequiredServers,
+		minimum:          cfg.MinServers,
+		interval:         time.Duration(cfg.Interval),
+		timeout:          time.Duration(cfg.Timeout),
+		failureThreshold: cfg.FailureThreshold,
+		reconnect:        cfg.Reconnect,
+	}
+	if p.readiness == "" {
+		p.readiness = readinessAny
+	}
+	if p.timeout <= 0 {
+		p.timeout = defaultHealthTimeout
+	}
+	if p.failureThreshold <= 0 {
+		p.failureThreshold = defaultFailureThreshold
+	}
+
+	switch p.readiness {
+	case readinessAny, readinessAll:
+	case readinessRequired:
+		if len(p.required) == 0 {
+			return nil, fmt.Errorf("requiredServers is required for the required readiness policy")
+		}
+	case readinessMinimum:
+		if p.minimum <= 0 {
+			return nil, fmt.Errorf("minServers must be positive for the minimum readiness policy")
+		}
+	default:
+		return nil, fmt.Errorf("invalid readiness policy %q", p.readiness)
+	}
+	if p.interval < 0 {
+		return nil, fmt.Errorf("interval must not be negative")
+	}
+	return p, nil
+}
+
+// WithHealthPolicy sets the readiness policy and health checks of the servers
+func WithHealthPolicy(policy *HealthPolicy) ServerOption {
+	return func(s *Server) {
+		s.healthPolicy = policy
+	}
+}
+
+// clientHealth is the result of the health checks of a client
+type clientHealth struct {
+	mu        sync.Mutex
+	unhealthy bool
+	lastCheck time.Time
+	latency   time.Duration
+	failures  int
+	lastErr   string
+}
+
+func newClientHealth() *clientHealth {
+	return &clientHealth{}
+}
+
+// record stores the result of a check and returns whether the client is
+// healthy. It becomes unhealthy after threshold consecutive failures.
+func (h *clientHealth) record(err error, latency time.Duration, threshold int) bool {
+	if h == nil {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastCheck = time.Now()
+	h.latency = latency
+	if err != nil {
+		h.failures++
+		h.lastErr = err.Error()
+		if h.failures >= threshold {
+			h.unhealthy = true
+		}
+	} else {
+		h.failures = 0
+		h.lastErr = ""
+		h.unhealthy = false
+	}
+	return !h.unhealthy
+}
+
+// healthy reports whether the client passes its health checks. Unchecked
+// clients are healthy.
+func (h *clientHealth) healthy() bool {
+	if h == nil {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !h.unhealthy
+}
+
+// serverHealth is the state of a server in /health/servers
+type serverHealth struct {
+	Name                string     `json:"name"`
+	Status              string     `json:"status"`
+	Ready               bool       `json:"ready"`
+	LastCheck           *time.Time `json:"lastCheck,omitempty"`
+	LatencyMs           float64    `json:"latencyMs,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures,omitempty"`
+	Error               string     `json:"error,omitempty"`
+}
+
+// describe adds the check results of the client to the server state
+func (h *clientHealth) describe(state *serverHealth) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lastCheck.IsZero() {
+		return
+	}
+	lastCheck := h.lastCheck
+	state.LastCheck = &lastCheck
+	state.LatencyMs = float64(h.latency.Microseconds()) / 1000
+	state.ConsecutiveFailures = h.failures
+	if h.lastErr != "" {
+		state.Error = h.lastErr
+	}
+	if h.unhealthy {
+		state.Status = upstreamStatusUnhealthy
+	}
+}
+
+// serverHealth returns the state of every configured or running server,
+// sorted by name. A server is ready if it runs and passes its health checks.
+func (s *Server) serverHealth() []serverHealth {
+	s.initMu.RLock()
+	clients := s.mcpClients
+	states := make(map[string]serverHealth, len(s.upstreams))
+	for name, upstream := range s.upstreams {
+		state := serverHealth{Name: name, Status: upstreamStatusStarting, Error: upstream.lastErr}
+		switch {
+		case upstream.disabled:
+			state.Status = upstreamStatusDisabled
+		case upstream.lastErr != "" && clients[name] == nil:
+			state.Status = upstreamStatusFailed
+		}
+		states[name] = state
+	}
+	s.initMu.RUnlock()
+
+	for name, client := range clients {
+		state := serverHealth{Name: name, Status: upstreamStatusRunning}
+		client.health.describe(&state)
+		state.Ready = state.Status == upstreamStatusRunning
+		states[name] = state
+	}
+
+	servers := make([]serverHealth, 0, len(states))
+	for _, state := range states {
+		servers = append(servers, state)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	return servers
+}
+
+// ready evaluates the readiness policy against the state of the servers
+func (p *HealthPolicy) ready(servers []serverHealth) bool {
+	readiness := readinessAny
+	if p != nil {
+		readiness = p.readiness
+	}
+
+	readyCount := 0
+	enabled := 0
+	byName := make(map[string]serverHealth, len(servers))
+	for _, server := range servers {
+		byName[server.Name] = server
+		if server.Ready {
+			readyCount++
+		}
+		if server.Status != upstreamStatusDisabled {
+			enabled++
+		}
+	}
+
+	switch readiness {
+	case readinessAll:
+		return readyCount > 0 && readyCount == enabled
+	case readinessRequired:
+		for _, name := range p.required {
+			if !byName[name].Ready {
+				return false
+			}
+		}
+		return true
+	case readinessMinimum:
+		return readyCount >= p.minimum
+	default:
+		return readyCount > 0
+	}
+}
+
+// handleServerHealth serves GET /health/servers with the readiness and the
+// state of each server. The status is 503 while the proxy is not ready. The
+// endpoint is not authenticated, so the errors are left out.
+func (s *Server) handleServerHealth(w http.ResponseWriter, r *http.Request) {
+	s.writeServerHealth(w, false)
+}
+
+// handleAdminServerHealth serves GET /admin/health/servers, which is
+// /health/servers with the errors of the servers
+func (s *Server) handleAdminServerHealth(w http.ResponseWriter, r *http.Request) {
+	s.writeServerHealth(w, true)
+}
+
+func (s *Server) writeServerHealth(w http.ResponseWriter, withErrors bool) {
+	servers := s.serverHealth()
+	if !withErrors {
+		for i := range servers {
+			servers[i].Error = ""
+		}
+	}
+	ready := s.healthPolicy.ready(servers) && !s.draining.Load()
+	readiness := readinessAny
+	if s.healthPolicy != nil {
+		readiness = s.healthPolicy.readiness
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"ready":     ready,
+		"readiness": readiness,
+		"draining":  s.draining.Load(),
+		"servers":   servers,
+	}); err != nil {
+		s.logger.Error("Failed to write server health response", "error", err)
+	}
+}
+
+// RunHealthChecks pings every running server at the interval of the health
+// policy until ctx is done. It returns at once if no interval is set.
+func (s *Server) RunHealthChecks(ctx context.Context) {
+	if s.healthPolicy == nil || s.healthPolicy.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.healthPolicy.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkHealth(ctx)
+		}
+	}
+}
+
+// checkHealth pings all running servers at once
+func (s *Server) checkHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for name, client := range s.clients() {
+		wg.Add(1)
+		go func(name string, client *MCPClient) {
+			defer wg.Done()
+			s.checkClient(ctx, name, client)
+		}(name, client)
+	}
+	wg.Wait()
+}
+
+// checkClient pings the server and records the result. Unhealthy servers
+// are reconnected if the policy says so.
+func (s *Server) checkClient(ctx context.Context, name string, client *MCPClient) {
+	pingCtx, cancel := context.WithTimeout(ctx, s.healthPolicy.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := client.Ping(pingCtx)
+	if err != nil {
+		// The error is kept for /admin/health/servers
+		err = errors.New(s.redactor.redactString(err.Error()))
+	}
+	wasHealthy := client.health.healthy()
+	healthy := client.health.record(err, time.Since(start), s.healthPolicy.failureThreshold)
+
+	switch {
+	case wasHealthy && !healthy:
+		s.logger.Warn("MCP server is unhealthy", "server_name", name, "error", err)
+	case !wasHealthy && healthy:
+		s.logger.Info("MCP server is healthy again", "server_name", name)
+	case err != nil:
+		s.logger.Debug("MCP server health check failed", "server_name", name, "error", err)
+	}
+
+	if !healthy && s.healthPolicy.reconnect {
+		s.reconnectClient(ctx, name, client)
+	}
+}
+
+// reconnectClient replaces the unhealthy client of the named server with a
+// new one, unless it was replaced or the server disabled meanwhile. The
+// unhealthy client keeps running if the new one fails to start.
+func (s *Server) reconnectClient(ctx context.Context, name string, client *MCPClient) {
+	s.manageMu.Lock()
+	defer s.manageMu.Unlock()
+
+	state, err := s.upstream(name)
+	if err != nil {
+		return
+	}
+	s.initMu.RLock()
+	current := s.mcpClients[name]
+	disabled := state.disabled
+	s.initMu.RUnlock()
+	// Reloads reconfigure clients in place, sharing the connection
+	if disabled || current == nil || current.client != client.client {
+		return
+	}
+
+	if err := s.replaceClient(ctx, name, state); err != nil {
+		s.logger.Warn("Failed to reconnect unhealthy MCP server", "server_name", name, "error", s.redactor.redactString(err.Error()))
+		return
+	}
+	s.metrics.observeUpstreamRestart(name)
+	s.logger.Info("MCP server reconnected", "server_name", name)
+}
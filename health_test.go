@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+func TestNewHealthPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *HealthConfig
+		wantErr bool
+	}{
+		{name: "Defaults", cfg: &HealthConfig{}},
+		{name: "All", cfg: &HealthConfig{Readiness: "all", Interval: Duration(time.Second)}},
+		{name: "Required", cfg: &HealthConfig{Readiness: "required", RequiredServers: []string{"a"}}},
+		{name: "Required without servers", cfg: &HealthConfig{Readiness: "required"}, wantErr: true},
+		{name: "Minimum", cfg: &HealthConfig{Readiness: "minimum", MinServers: 2}},
+		{name: "Minimum without count", cfg: &HealthConfig{Readiness: "minimum"}, wantErr: true},
+		{name: "Unknown policy", cfg: &HealthConfig{Readiness: "most"}, wantErr: true},
+		{name: "Negative interval", cfg: &HealthConfig{Interval: Duration(-time.Second)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewHealthPolicy(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewHealthPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (p.timeout != defaultHealthTimeout || p.failureThreshold != defaultFailureThreshold) {
+				t.Errorf("expected default timeout and threshold, got %+v", p)
+			}
+		})
+	}
+}
+
+func TestHealthPolicyReady(t *testing.T) {
+	servers := []serverHealth{
+		{Name: "a", Status: upstreamStatusRunning, Ready: true},
+		{Name: "b", Status: upstreamStatusRunning, Ready: true},
+		{Name: "c", Status: upstreamStatusUnhealthy},
+		{Name: "d", Status: upstreamStatusDisabled},
+	}
+	allUp := []serverHealth{servers[0], servers[1], servers[3]}
+
+	tests := []struct {
+		name     string
+		policy   *HealthPolicy
+		servers  []serverHealth
+		expected bool
+	}{
+		{name: "Default", servers: servers, expected: true},
+		{name: "Default without servers", expected: false},
+		{name: "Any", policy: &HealthPolicy{readiness: readinessAny}, servers: servers, expected: true},
+		{name: "All with an unhealthy server", policy: &HealthPolicy{readiness: readinessAll}, servers: servers, expected: false},
+		{name: "All ignores disabled servers", policy: &HealthPolicy{readiness: readinessAll}, servers: allUp, expected: true},
+		{name: "All without servers", policy: &HealthPolicy{readiness: readinessAll}, expected: false},
+		{name: "Required ready", policy: &HealthPolicy{readiness: readinessRequired, required: []string{"a", "b"}}, servers: servers, expected: true},
+		{name: "Required unhealthy", policy: &HealthPolicy{readiness: readinessRequired, required: []string{"a", "c"}}, servers: servers, expected: false},
+		{name: "Required unknown", policy: &HealthPolicy{readiness: readinessRequired, required: []string{"x"}}, servers: servers, expected: false},
+		{name: "Minimum met", policy: &HealthPolicy{readiness: readinessMinimum, minimum: 2}, servers: servers, expected: true},
+		{name: "Minimum not met", policy: &HealthPolicy{readiness: readinessMinimum, minimum: 3}, servers: servers, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.ready(tt.servers); got != tt.expected {
+				t.Errorf("ready() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientHealthRecord(t *testing.T) {
+	h := newClientHealth()
+	failure := errors.New("timeout")
+
+	steps := []struct {
+		err      error
+		expected bool
+	}{
+		{err: failure, expected: true},
+		{err: failure, expected: false},
+		{err: failure, expected: false},
+		{err: nil, expected: true},
+		{err: failure, expected: true},
+	}
+	for i, step := range steps {
+		if got := h.record(step.err, time.Millisecond, 2); got != step.expected {
+			t.Errorf("step %d: record() = %v, want %v", i, got, step.expected)
+		}
+		if h.healthy() != step.expected {
+			t.Errorf("step %d: healthy() = %v, want %v", i, h.healthy(), step.expected)
+		}
+	}
+}
+
+func TestServerHealthEndpoint(t *testing.T) {
+	srv := mcpserver.NewMCPServer("upstream", "1.0.0", mcpserver.WithToolCapabilities(false))
+	srv.AddTool(mcp.NewTool("ping"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("pong"), nil
+	})
+	dying := mcpserver.NewTestStreamableHTTPServer(srv)
+	defer dying.Close()
+
+	server := newManagedTestServer(t, map[string]*MCPClientConfig{
+		"up":     {Name: "up", Url: newTestUpstream(t)},
+		"dying":  {Name: "dying", Url: dying.URL + "/mcp"},
+		"broken": {Name: "broken", Command: "/nonexistent/mcp-server"},
+	})
+	policy, err := NewHealthPolicy(&HealthConfig{Readiness: readinessRequired, RequiredServers: []string{"up", "dying"}, Timeout: Duration(time.Second), FailureThreshold: 1})
+	if err != nil {
+		t.Fatalf("NewHealthPolicy failed: %v", err)
+	}
+	WithHealthPolicy(policy)(server)
+	redactor, err := NewRedactor(&RedactionConfig{Patterns: []string{`127\.0\.0\.1:\d+`}})
+	if err != nil {
+		t.Fatalf("NewRedactor failed: %v", err)
+	}
+	WithRedactor(redactor)(server)
+
+	getFrom := func(handler http.Handler, path string) (int, map[string]serverHealth) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		handler.ServeHTTP(w, req)
+		var body struct {
+			Ready   bool           `json:"ready"`
+			Servers []serverHealth `json:"servers"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		servers := make(map[string]serverHealth)
+		for _, s := range body.Servers {
+			servers[s.Name] = s
+		}
+		if body.Ready != (w.Code == http.StatusOK) {
+			t.Errorf("ready = %v with status %d", body.Ready, w.Code)
+		}
+		return w.Code, servers
+	}
+	get := func() (int, map[string]serverHealth) {
+		return getFrom(server.routes(), "/health/servers")
+	}
+
+	server.checkHealth(context.Background())
+	code, servers := get()
+	if code != http.StatusOK {
+		t.Fatalf("expected 200 with the required servers up, got %d", code)
+	}
+	if !servers["up"].Ready || servers["up"].LastCheck == nil || servers["broken"].Status != upstreamStatusFailed || servers["broken"].Ready {
+		t.Errorf("unexpected server states %+v", servers)
+	}
+
+	dying.Close()
+	server.checkHealth(context.Background())
+	code, servers = get()
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 with a required server unhealthy, got %d", code)
+	}
+	if servers["dying"].Status != upstreamStatusUnhealthy || servers["dying"].ConsecutiveFailures != 1 {
+		t.Errorf("expected the closed server to be unhealthy, got %+v", servers["dying"])
+	}
+	if servers["dying"].Error != "" || servers["broken"].Error != "" {
+		t.Errorf("expected no errors on the public endpoint, got %+v", servers)
+	}
+
+	// The admin endpoint has the redacted errors
+	_, servers = getFrom(server.adminRoutes(), "/admin/health/servers")
+	if err := servers["dying"].Error; !strings.Contains(err, "[REDACTED]") || strings.Contains(err, "127.0.0.1") {
+		t.Errorf("expected the redacted error of the closed server, got %q", err)
+	}
+	if servers["broken"].Error == "" {
+		t.Errorf("expected the start error of the broken server, got %+v", servers["broken"])
+	}
+
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest("GET", "/health/readiness", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected readiness to fail, got %d", w.Code)
+	}
+}
+
+func TestPingMethod(t *testing.T) {
+	for _, splitMode := range []bool{false, true} {
+		server := newScopedTestServer(t, splitMode)
+		path := "/"
+		if splitMode {
+			path = "/a"
+		}
+		w, resp := doJSONRPC(t, server, path, "limited-key", `{"jsonrpc":"2.0","method":"ping","id":1}`)
+		if w.Code != http.StatusOK || resp.Error != nil {
+			t.Errorf("splitMode=%v: expected an empty result, got %d %+v", splitMode, w.Code, resp)
+		}
+	}
+}
+
+// forgetfulSessions is a session ID manager whose sessions end when the
+// upstream restarts
+type forgetfulSessions struct {
+	mu       sync.Mutex
+	next     int
+	sessions map[string]bool
+}
+
+func (m *forgetfulSessions) Generate() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next++
+	id := fmt.Sprintf("session-%d", m.next)
+	m.sessions[id] = true
+	return id
+}
+
+func (m *forgetfulSessions) Validate(sessionID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.sessions[sessionID] {
+		return false, fmt.Errorf("unknown session %s", sessionID)
+	}
+	return false, nil
+}
+
+func (m *forgetfulSessions) Terminate(sessionID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, sessionID)
+	return false, nil
+}
+
+func (m *forgetfulSessions) restart() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions = map[string]bool{}
+}
+
+func TestReconnectUnhealthyClient(t *testing.T) {
+	sessions := &forgetfulSessions{sessions: map[string]bool{}}
+	ts := httptest.NewServer(mcpserver.NewStreamableHTTPServer(
+		mcpserver.NewMCPServer("upstream", "1.0.0"),
+		mcpserver.WithSessionIdManager(sessions)))
+	defer ts.Close()
+
+	server := newManagedTestServer(t, map[string]*MCPClientConfig{"remote": {Name: "remote", Url: ts.URL}})
+	policy, err := NewHealthPolicy(&HealthConfig{Timeout: Duration(time.Second), FailureThreshold: 2, Reconnect: true})
+	if err != nil {
+		t.Fatalf("NewHealthPolicy failed: %v", err)
+	}
+	WithHealthPolicy(policy)(server)
+	before := server.clients()["remote"]
+	if before == nil {
+		t.Fatal("expected the server to start")
+	}
+
+	server.checkHealth(context.Background())
+	if server.clients()["remote"] != before || !before.health.healthy() {
+		t.Fatal("expected the client to pass its health check")
+	}
+
+	sessions.restart()
+	server.checkHealth(context.Background())
+	if server.clients()["remote"] != before {
+		t.Fatal("expected no reconnect before the failure threshold")
+	}
+	server.checkHealth(context.Background())
+	after := server.clients()["remote"]
+	if after == nil || after == before {
+		t.Fatal("expected the unhealthy client to be reconnected")
+	}
+	if err := after.Ping(context.Background()); err != nil {
+		t.Errorf("expected the new client to respond, got %v", err)
+	}
+	if !after.health.healthy() {
+		t.Error("expected the new client to be healthy")
+	}
+}
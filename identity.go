@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// callerMetaKey is the _meta key under which the caller identity is sent to upstream servers
+const callerMetaKey = "mcp-proxy/caller"
+
+// Caller describes who sent a request to the proxy
+type Caller struct {
+	ID     string   `json:"id"`
+	Groups []string `json:"groups,omitempty"`
+
+	// If restricted, the caller may only use what one of the scopes allows
+	restricted bool
+	scopes     []AccessScope
+}
+
+// allowsServer checks if the caller may use any tool of the server
+func (c *Caller) allowsServer(serverName string) bool {
+	if c == nil || !c.restricted {
+		return true
+	}
+	for _, scope := range c.scopes {
+		if scope.allowsServer(serverName) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows checks if the caller may call the tool on the server
+func (c *Caller) allows(serverName, toolName string) bool {
+	if c == nil || !c.restricted {
+		return true
+	}
+	for _, scope := range c.scopes {
+		if scope.allowsServer(serverName) && scope.allowsTool(toolName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s AccessScope) allowsServer(serverName string) bool {
+	if len(s.Servers) == 0 {
+		return true
+	}
+	for _, name := range s.Servers {
+		if name == serverName {
+			return true
+		}
+	}
+	return false
+}
+
+func (s AccessScope) allowsTool(toolName string) bool {
+	if len(s.Tools) == 0 {
+		return true
+	}
+	for _, pattern := range s.Tools {
+		if matched, err := path.Match(pattern, toolName); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey int
+
+const (
+	callerContextKey contextKey = iota
+	inboundHeadersContextKey
+	clientIPContextKey
+	toolCallContextKey
+)
+
+// withCaller returns a context carrying the caller identity
+func withCaller(ctx context.Context, caller *Caller) context.Context {
+	return context.WithValue(ctx, callerContextKey, caller)
+}
+
+// callerFromContext returns the caller identity, or nil if the caller is unknown
+func callerFromContext(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(callerContextKey).(*Caller)
+	return caller
+}
+
+// callerID returns the ID of the caller in ctx for logging, or "" if the caller is unknown
+func callerID(ctx context.Context) string {
+	if caller := callerFromContext(ctx); caller != nil {
+		return caller.ID
+	}
+	return ""
+}
+
+// withInboundHeaders returns a context carrying the headers of the downstream request
+func withInboundHeaders(ctx context.Context, headers http.Header) context.Context {
+	return context.WithValue(ctx, inboundHeadersContextKey, headers)
+}
+
+// forwardableHeaders returns the headers of the downstream request without
+// the credentials the proxy itself checks, which are never sent upstream
+func (s *Server) forwardableHeaders(r *http.Request) http.Header {
+	headers := r.Header.Clone()
+	headers.Del(adminTokenHeader)
+	if s.authenticator != nil {
+		if name := s.authenticator.credentialHeader(r); name != "" {
+			headers.Del(name)
+		}
+	}
+	return headers
+}
+
+// withToolCall returns a context for a tools/call request to an upstream.
+// Downstream headers are only forwarded on tool calls, since tool lists are
+// cached and shared by all callers.
+func withToolCall(ctx context.Context) context.Context {
+	return context.WithValue(ctx, toolCallContextKey, true)
+}
+
+// isToolCall checks if ctx is the context of a tools/call request to an upstream
+func isToolCall(ctx context.Context) bool {
+	toolCall, _ := ctx.Value(toolCallContextKey).(bool)
+	return toolCall
+}
+
+// inboundHeadersFromContext returns the headers of the downstream request, if any
+func inboundHeadersFromContext(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(inboundHeadersContextKey).(http.Header)
+	return headers
+}
+
+// withClientIP returns a context carrying the IP address the request came from
+func withClientIP(ctx context.Context, r *http.Request) context.Context {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return context.WithValue(ctx, clientIPContextKey, ip)
+}
+
+// clientIPFromContext returns the IP address of the downstream client, if known
+func clientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPContextKey).(string)
+	return ip
+}
+
+// callerFromIdentityHeader reads the caller identity from a header set by a trusted
+// authenticating proxy in front of mcp-proxy
+func callerFromIdentityHeader(r *http.Request, header string) *Caller {
+	if header == "" {
+		return nil
+	}
+	id := strings.TrimSpace(r.Header.Get(header))
+	if id == "" {
+		return nil
+	}
+	return &Caller{ID: id}
+}
+
+// forwardedHeaders returns the allowlisted downstream headers to send to an
+// HTTP upstream on tool calls
+func (c *MCPClient) forwardedHeaders(ctx context.Context) map[string]string {
+	headers := make(map[string]string)
+	inbound := inboundHeadersFromContext(ctx)
+	if c.config.Extensions != nil && c.config.Extensions.Forward != nil && inbound != nil && isToolCall(ctx) {
+		for _, name := range c.config.Extensions.Forward.Headers {
+			if value := inbound.Get(name); value != "" {
+				headers[http.CanonicalHeaderKey(name)] = value
+			}
+		}
+	}
+	// The trace context of the upstream call replaces any forwarded one
+	return injectTraceHeaders(ctx, headers)
+}
+
+// callerMeta returns the _meta fields that carry the caller identity upstream
+func (c *MCPClient) callerMeta(ctx context.Context) map[string]interface{} {
+	if c.config.Extensions == nil || c.config.Extensions.Forward == nil || !c.config.Extensions.Forward.Identity {
+		return nil
+	}
+	caller := callerFromContext(ctx)
+	if caller == nil {
+		return nil
+	}
+	return map[string]interface{}{callerMetaKey: caller}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+func TestCallerFromIdentityHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		headers  map[string]string
+		expected *Caller
+	}{
+		{
+			name:     "No identity header configured",
+			headers:  map[string]string{"X-User-Id": "alice"},
+			expected: nil,
+		},
+		{
+			name:     "Identity header present",
+			header:   "X-User-Id",
+			headers:  map[string]string{"X-User-Id": "alice"},
+			expected: &Caller{ID: "alice"},
+		},
+		{
+			name:     "Identity header missing",
+			header:   "X-User-Id",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			got := callerFromIdentityHeader(req, tt.header)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("callerFromIdentityHeader() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	inbound := http.Header{}
+	inbound.Set("Authorization", "Bearer user-token")
+	inbound.Set("X-User-Id", "alice")
+	inbound.Set("Cookie", "session=secret")
+	ctx := withToolCall(withInboundHeaders(context.Background(), inbound))
+
+	tests := []struct {
+		name     string
+		config   *MCPClientConfig
+		ctx      context.Context
+		expected map[string]string
+	}{
+		{
+			name:     "No forward config",
+			config:   &MCPClientConfig{},
+			ctx:      ctx,
+			expected: nil,
+		},
+		{
+			name: "Only allowlisted headers are forwarded",
+			config: &MCPClientConfig{Extensions: &Extensions{
+				Forward: &ForwardExtensions{Headers: []string{"authorization", "X-User-Id", "X-Missing"}},
+			}},
+			ctx: ctx,
+			expected: map[string]string{
+				"Authorization": "Bearer user-token",
+				"X-User-Id":     "alice",
+			},
+		},
+		{
+			name: "No downstream request",
+			config: &MCPClientConfig{Extensions: &Extensions{
+				Forward: &ForwardExtensions{Headers: []string{"Authorization"}},
+			}},
+			ctx:      withToolCall(context.Background()),
+			expected: nil,
+		},
+		{
+			name: "Not a tool call",
+			config: &MCPClientConfig{Extensions: &Extensions{
+				Forward: &ForwardExtensions{Headers: []string{"Authorization"}},
+			}},
+			ctx:      withInboundHeaders(context.Background(), inbound),
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &MCPClient{config: tt.config}
+			got := c.forwardedHeaders(tt.ctx)
+			if len(got) == 0 && len(tt.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("forwardedHeaders() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestForwardedHeadersSentUpstream(t *testing.T) {
+	recorder := &headerRecorder{}
+	srv := mcpserver.NewMCPServer("upstream", "1.0.0", mcpserver.WithToolCapabilities(false))
+	srv.AddTools(echoMetaTool())
+	ts := httptest.NewServer(recorder.wrap(mcpserver.NewStreamableHTTPServer(srv)))
+	defer ts.Close()
+
+	c, err := NewMCPClient(&MCPClientConfig{
+		Url: ts.URL,
+		Extensions: &Extensions{
+			Forward: &ForwardExtensions{Headers: []string{"X-User-Id"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewMCPClient failed: %v", err)
+	}
+	defer c.Close()
+
+	inbound := http.Header{}
+	inbound.Set("X-User-Id", "alice")
+	inbound.Set("X-Not-Forwarded", "value")
+	ctx, cancel := context.WithTimeout(withInboundHeaders(context.Background(), inbound), 5*time.Second)
+	defer cancel()
+
+	if _, err := c.Initialize(context.Background()); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	last := func() http.Header {
+		received := recorder.all()
+		if len(received) == 0 {
+			t.Fatal("no requests received")
+		}
+		return received[len(received)-1]
+	}
+
+	// Tool lists are shared by all callers, so they are listed without the caller's headers
+	if _, err := c.ListTools(ctx); err != nil {
+		t.Fatalf("ListTools failed: %v", err)
+	}
+	if got := last().Get("X-User-Id"); got != "" {
+		t.Errorf("expected no forwarded headers on tools/list, got X-User-Id %q", got)
+	}
+
+	if _, err := c.CallTool(ctx, "whoami", nil); err != nil {
+		t.Fatalf("CallTool failed: %v", err)
+	}
+	if got := last().Get("X-User-Id"); got != "alice" {
+		t.Errorf("expected X-User-Id to be forwarded, got %q", got)
+	}
+	if got := last().Get("X-Not-Forwarded"); got != "" {
+		t.Errorf("header outside the allowlist was forwarded: %q", got)
+	}
+}
+
+func TestForwardableHeaders(t *testing.T) {
+	auth, err := NewAuthenticator(&AuthConfig{APIKeys: []APIKeyConfig{{Name: "k", Key: "proxy-key"}}})
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		auth     *Authenticator
+		headers  map[string]string
+		expected []string
+	}{
+		{
+			name:     "API key header is dropped",
+			auth:     auth,
+			headers:  map[string]string{"X-API-Key": "proxy-key", "Authorization": "Bearer user-token"},
+			expected: []string{"Authorization"},
+		},
+		{
+			name:     "Bearer credential is dropped",
+			auth:     auth,
+			headers:  map[string]string{"Authorization": "Bearer proxy-key", "X-User-Id": "alice"},
+			expected: []string{"X-User-Id"},
+		},
+		{
+			name:     "Admin token is dropped",
+			headers:  map[string]string{"X-Admin-Token": "admin-secret", "Authorization": "Bearer user-token"},
+			expected: []string{"Authorization"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(map[string]*MCPClient{}, false)
+			server.authenticator = tt.auth
+			req := httptest.NewRequest("POST", "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			var got []string
+			for name := range server.forwardableHeaders(req) {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("forwardableHeaders() = %v, want %v", got, tt.expected)
+			}
+			if len(req.Header) != len(tt.headers) {
+				t.Errorf("expected the request headers to be kept, got %v", req.Header)
+			}
+		})
+	}
+}
+
+// echoMetaTool returns a tool that answers with the _meta fields it receives
+func echoMetaTool() mcpserver.ServerTool {
+	return mcpserver.ServerTool{
+		Tool: mcp.NewTool("whoami"),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var fields map[string]any
+			if request.Params.Meta != nil {
+				fields = request.Params.Meta.AdditionalFields
+			}
+			b, err := json.Marshal(fields)
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewToolResultText(string(b)), nil
+		},
+	}
+}
+
+func TestCallerIdentityInMeta(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity bool
+		caller   *Caller
+		expected string
+	}{
+		{
+			name:     "Identity forwarding enabled",
+			identity: true,
+			caller:   &Caller{ID: "alice", Groups: []string{"oncall"}},
+			expected: `{"mcp-proxy/caller":{"groups":["oncall"],"id":"alice"}}`,
+		},
+		{
+			name:     "Identity forwarding disabled",
+			identity: false,
+			caller:   &Caller{ID: "alice"},
+			expected: `null`,
+		},
+		{
+			name:     "Unknown caller",
+			identity: true,
+			expected: `null`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newInProcessMCPClient(t, &MCPClientConfig{
+				Extensions: &Extensions{Forward: &ForwardExtensions{Identity: tt.identity}},
+			}, echoMetaTool())
+
+			ctx := context.Background()
+			if tt.caller != nil {
+				ctx = withCaller(ctx, tt.caller)
+			}
+			result, err := c.CallTool(ctx, "whoami", nil)
+			if err != nil {
+				t.Fatalf("CallTool failed: %v", err)
+			}
+			text := result.Content[0].(mcp.TextContent).Text
+			if text != tt.expected {
+				t.Errorf("upstream received _meta %s, want %s", text, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProcessRequestIdentityHeader(t *testing.T) {
+	c := newInProcessMCPClient(t, &MCPClientConfig{
+		Extensions: &Extensions{Forward: &ForwardExtensions{Identity: true}},
+	}, echoMetaTool())
+	server := NewServer(map[string]*MCPClient{"server1": c}, true, WithIdentityHeader("X-User-Id"))
+
+	req := httptest.NewRequest("POST", "/server1", strings.NewReader(`{"jsonrpc":"2.0","method":"tools/call","params":{"name":"whoami"},"id":1}`))
+	req.Header.Set("X-User-Id", "bob")
+	w := httptest.NewRecorder()
+	server.handleJSONRPC(w, req)
+
+	if !strings.Contains(w.Body.String(), `\"id\":\"bob\"`) {
+		t.Errorf("expected caller identity to reach the upstream, got %s", w.Body.String())
+	}
+}
+
+func TestCallerAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   *Caller
+		server   string
+		tool     string
+		expected bool
+	}{
+		{
+			name:     "Unknown caller is not restricted",
+			caller:   nil,
+			server:   "a",
+			tool:     "anything",
+			expected: true,
+		},
+		{
+			name:     "Unrestricted caller",
+			caller:   &Caller{ID: "alice"},
+			server:   "a",
+			tool:     "anything",
+			expected: true,
+		},
+		{
+			name:     "Restricted caller without scopes",
+			caller:   &Caller{ID: "alice", restricted: true},
+			server:   "a",
+			tool:     "anything",
+			expected: false,
+		},
+		{
+			name: "Tool pattern matches",
+			caller: &Caller{ID: "alice", restricted: true, scopes: []AccessScope{
+				{Servers: []string{"a"}, Tools: []string{"get_*", "list_*"}},
+			}},
+			server:   "a",
+			tool:     "list_issues",
+			expected: true,
+		},
+		{
+			name: "Tool pattern does not match",
+			caller: &Caller{ID: "alice", restricted: true, scopes: []AccessScope{
+				{Servers: []string{"a"}, Tools: []string{"get_*"}},
+			}},
+			server:   "a",
+			tool:     "delete_issue",
+			expected: false,
+		},
+		{
+			name: "Server outside the scope",
+			caller: &Caller{ID: "alice", restricted: true, scopes: []AccessScope{
+				{Servers: []string{"a"}},
+			}},
+			server:   "b",
+			tool:     "get_issue",
+			expected: false,
+		},
+		{
+			name: "Any matching scope allows",
+			caller: &Caller{ID: "alice", restricted: true, scopes: []AccessScope{
+				{Servers: []string{"a"}, Tools: []string{"get_*"}},
+				{Servers: []string{"b"}},
+			}},
+			server:   "b",
+			tool:     "delete_doc",
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.caller.allows(tt.server, tt.tool); got != tt.expected {
+				t.Errorf("allows(%s, %s) = %v, want %v", tt.server, tt.tool, got, tt.expected)
+			}
+		})
+	}
+}
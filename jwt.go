@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// Keys fetched from a JWKS URL are refreshed after this long
+	jwksCacheTTL = time.Hour
+	// Minimum interval between fetches triggered by an unknown key ID
+	jwksMinRefreshInterval = time.Minute
+	// Time limit of a JWKS fetch, independent of the request that started it
+	jwksFetchTimeout    = 10 * time.Second
+	defaultSubjectClaim = "sub"
+	defaultGroupsClaim  = "groups"
+)
+
+// Signing algorithms accepted in tokens. Symmetric algorithms are not
+// accepted since the keys come from a public JWKS.
+var jwtValidMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// jwtValidator validates JWT bearer tokens and maps their claims to a Caller
+type jwtValidator struct {
+	config *JWTConfig
+	keys   *jwksKeySet
+	parser *jwt.Parser
+}
+
+func newJWTValidator(cfg *JWTConfig, logger *slog.Logger) (*jwtValidator, error) {
+	if (cfg.JWKSURL == "") == (cfg.JWKSFile == "") {
+		return nil, fmt.Errorf("exactly one of jwksUrl and jwksFile must be set")
+	}
+	for group, scope := range cfg.Groups {
+		for _, pattern := range scope.Tools {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("group %s has invalid tool pattern %q: %w", group, pattern, err)
+			}
+		}
+	}
+
+	keys := &jwksKeySet{
+		url:        cfg.JWKSURL,
+		httpClient: &http.Client{Timeout: jwksFetchTimeout},
+		logger:     logger,
+		now:        time.Now,
+	}
+	if cfg.JWKSFile != "" {
+		buf, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		parsed, err := parseJWKS(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWKS file: %w", err)
+		}
+		keys.keys = parsed
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtValidMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	} else {
+		logger.Warn("No JWT audience configured; tokens issued for any audience of the identity provider are accepted")
+	}
+
+	return &jwtValidator{
+		config: cfg,
+		keys:   keys,
+		parser: jwt.NewParser(opts...),
+	}, nil
+}
+
+// validate verifies the token and returns the caller it identifies
+func (v *jwtValidator) validate(ctx context.Context, tokenString string) (*Caller, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	subjectClaim := v.config.SubjectClaim
+	if subjectClaim == "" {
+		subjectClaim = defaultSubjectClaim
+	}
+	subject, _ := claims[subjectClaim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("token has no %s claim", subjectClaim)
+	}
+
+	groupsClaim := v.config.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = defaultGroupsClaim
+	}
+	caller := &Caller{
+		ID:     subject,
+		Groups: stringsClaim(claims[groupsClaim]),
+	}
+
+	if len(v.config.Groups) > 0 {
+		caller.restricted = true
+		for _, group := range caller.Groups {
+			if scope, ok := v.config.Groups[group]; ok {
+				caller.scopes = append(caller.scopes, scope)
+			}
+		}
+	}
+	return caller, nil
+}
+
+// stringsClaim reads a claim that is either a list of strings or a space separated string
+func stringsClaim(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// isJWT checks if the token looks like a compact serialized JWT
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// jwksKeySet holds the public keys of a JWKS, fetching them from a URL if one is configured
+type jwksKeySet struct {
+	url        string
+	httpClient *http.Client
+	logger     *slog.Logger
+	now        func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+	// When the last fetch completed, successfully or not
+	lastAttempt time.Time
+	// Closed when the running fetch is done; nil if none is running
+	refreshing chan struct{}
+}
+
+// key returns the public key with the given key ID. An empty key ID matches
+// the only key of a single-key set. Keys are fetched in the background
+// without holding the lock, so only callers with an unknown key ID wait for
+// a running fetch, and a caller giving up does not cancel it.
+func (s *jwksKeySet) key(ctx context.Context, kid string) (interface{}, error) {
+	if s.url != "" {
+		s.mu.Lock()
+		stale := s.now().Sub(s.fetchedAt) > jwksCacheTTL
+		_, known := s.keys[kid]
+		wait := s.refreshing
+		if wait == nil && (stale || !known) && s.now().Sub(s.lastAttempt) > jwksMinRefreshInterval {
+			wait = make(chan struct{})
+			s.refreshing = wait
+			go s.refresh(context.WithoutCancel(ctx))
+		}
+		s.mu.Unlock()
+
+		if wait != nil && !known {
+			select {
+			case <-wait:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, nil
+		}
+	}
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// refresh fetches the keys from the JWKS URL and wakes up the callers waiting
+// for them. On failure the previous keys are kept.
+func (s *jwksKeySet) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, jwksFetchTimeout)
+	defer cancel()
+	keys, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	s.lastAttempt = s.now()
+	if err == nil {
+		s.keys = keys
+		s.fetchedAt = s.now()
+	}
+	close(s.refreshing)
+	s.refreshing = nil
+	s.mu.Unlock()
+
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to fetch JWKS", "url", s.url, "error", err)
+		return
+	}
+	s.logger.DebugContext(ctx, "JWKS refreshed", "url", s.url, "keys", len(keys))
+}
+
+func (s *jwksKeySet) fetch(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned %s", resp.Status)
+	}
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(buf)
+}
+
+// parseJWKS parses the RSA and EC signing keys of a JSON Web Key Set
+func parseJWKS(buf []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(buf, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key interface{}
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = parseRSAJWK(k.N, k.E)
+		case "EC":
+			key, err = parseECJWK(k.Crv, k.X, k.Y)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable signing keys")
+	}
+	return keys, nil
+}
+
+func parseRSAJWK(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(eBytes)
+	if len(nBytes) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(exponent.Int64())}, nil
+}
+
+func parseECJWK(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	var ecdhCurve ecdh.Curve
+	switch crv {
+	case "P-256":
+		curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x coordinate: %w", err)
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y coordinate: %w", err)
+	}
+
+	// Check that the point is on the curve
+	size := (curve.Params().BitSize + 7) / 8
+	if len(xBytes) != size || len(yBytes) != size {
+		return nil, fmt.Errorf("invalid coordinate length")
+	}
+	point := append(append([]byte{4}, xBytes...), yBytes...)
+	if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("invalid EC point: %w", err)
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(xBytes),
+		Y:     new(big.Int).SetBytes(yBytes),
+	}, nil
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testJWK returns the public JWK of a locally generated key
+func testJWK(t *testing.T, kid string, key crypto.Signer) map[string]string {
+	t.Helper()
+	encode := base64.RawURLEncoding.EncodeToString
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA", "kid": kid, "use": "sig",
+			"n": encode(pub.N.Bytes()),
+			"e": encode(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"kty": "EC", "kid": kid, "crv": pub.Curve.Params().Name,
+			"x": encode(pub.X.FillBytes(make([]byte, size))),
+			"y": encode(pub.Y.FillBytes(make([]byte, size))),
+		}
+	}
+	t.Fatalf("unsupported key type %T", key)
+	return nil
+}
+
+func testJWKS(t *testing.T, keys ...map[string]string) []byte {
+	t.Helper()
+	buf, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatalf("Failed to marshal JWKS: %v", err)
+	}
+	return buf
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key crypto.Signer, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func validTestClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":    "https://issuer.example.com",
+		"aud":    "mcp-proxy",
+		"sub":    "alice",
+		"groups": []string{"readers"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWTValidator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, testJWKS(t, testJWK(t, "rsa", rsaKey), testJWK(t, "ec", ecKey)), 0600); err != nil {
+		t.Fatalf("Failed to write JWKS file: %v", err)
+	}
+
+	validator, err := newJWTValidator(&JWTConfig{
+		JWKSFile: jwksFile,
+		Issuer:   "https://issuer.example.com",
+		Audience: "mcp-proxy",
+		Groups: map[string]AccessScope{
+			"readers": {Tools: []string{"get_*"}},
+		},
+	}, WithComponent("auth"))
+	if err != nil {
+		t.Fatalf("newJWTValidator failed: %v", err)
+	}
+
+	withClaim := func(key string, value interface{}) jwt.MapClaims {
+		claims := validTestClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "RSA signed token",
+			token: signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, validTestClaims()),
+		},
+		{
+			name:  "EC signed token",
+			token: signTestToken(t, jwt.SigningMethodES256, "ec", ecKey, validTestClaims()),
+		},
+		{
+			name:    "Unknown signing key",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "rsa", otherKey, validTestClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "Unknown key ID",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "missing", rsaKey, validTestClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "Wrong issuer",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("iss", "https://evil.example.com")),
+			wantErr: true,
+		},
+		{
+			name:    "Wrong audience",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("aud", "other")),
+			wantErr: true,
+		},
+		{
+			name:    "Expired",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("exp", time.Now().Add(-time.Hour).Unix())),
+			wantErr: true,
+		},
+		{
+			name:    "Missing expiry",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("exp", nil)),
+			wantErr: true,
+		},
+		{
+			name:    "Missing subject",
+			token:   signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, withClaim("sub", nil)),
+			wantErr: true,
+		},
+		{
+			name: "Symmetric algorithm is rejected",
+			token: func() string {
+				signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validTestClaims()).SignedString([]byte("secret"))
+				if err != nil {
+					t.Fatalf("Failed to sign token: %v", err)
+				}
+				return signed
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller, err := validator.validate(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if caller.ID != "alice" || !reflect.DeepEqual(caller.Groups, []string{"readers"}) {
+				t.Errorf("unexpected caller %+v", caller)
+			}
+			if !caller.allows("any", "get_issue") || caller.allows("any", "delete_issue") {
+				t.Error("caller should be limited to the scope of its groups")
+			}
+		})
+	}
+}
+
+func TestJWTGroupScopes(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, testJWKS(t, testJWK(t, "k1", key)), 0600); err != nil {
+		t.Fatalf("Failed to write JWKS file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		config      JWTConfig
+		claims      jwt.MapClaims
+		expectedID  string
+		allowServer string
+		denyServer  string
+	}{
+		{
+			name:        "No group scopes gives full access",
+			config:      JWTConfig{JWKSFile: jwksFile},
+			claims:      jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()},
+			expectedID:  "alice",
+			allowServer: "github",
+		},
+		{
+			name: "Union of group scopes",
+			config: JWTConfig{JWKSFile: jwksFile, Groups: map[string]AccessScope{
+				"dev":    {Servers: []string{"github"}},
+				"oncall": {Servers: []string{"pagerduty"}},
+				"admin":  {},
+			}},
+			claims:      jwt.MapClaims{"sub": "bob", "groups": []string{"dev", "oncall"}, "exp": time.Now().Add(time.Hour).Unix()},
+			expectedID:  "bob",
+			allowServer: "pagerduty",
+			denyServer:  "jira",
+		},
+		{
+			name: "Custom claims",
+			config: JWTConfig{JWKSFile: jwksFile, SubjectClaim: "email", GroupsClaim: "roles", Groups: map[string]AccessScope{
+				"dev": {Servers: []string{"github"}},
+			}},
+			claims:      jwt.MapClaims{"sub": "123", "email": "carol@example.com", "roles": "dev viewer", "exp": time.Now().Add(time.Hour).Unix()},
+			expectedID:  "carol@example.com",
+			allowServer: "github",
+			denyServer:  "jira",
+		},
+		{
+			name: "No matching group",
+			config: JWTConfig{JWKSFile: jwksFile, Groups: map[string]AccessScope{
+				"dev": {Servers: []string{"github"}},
+			}},
+			claims:     jwt.MapClaims{"sub": "dave", "exp": time.Now().Add(time.Hour).Unix()},
+			expectedID: "dave",
+			denyServer: "github",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator, err := newJWTValidator(&tt.config, WithComponent("auth"))
+			if err != nil {
+				t.Fatalf("newJWTValidator failed: %v", err)
+			}
+			caller, err := validator.validate(context.Background(), signTestToken(t, jwt.SigningMethodES256, "k1", key, tt.claims))
+			if err != nil {
+				t.Fatalf("validate failed: %v", err)
+			}
+			if caller.ID != tt.expectedID {
+				t.Errorf("expected caller %s, got %s", tt.expectedID, caller.ID)
+			}
+			if tt.allowServer != "" && !caller.allowsServer(tt.allowServer) {
+				t.Errorf("expected access to %s", tt.allowServer)
+			}
+			if tt.denyServer != "" && caller.allowsServer(tt.denyServer) {
+				t.Errorf("expected no access to %s", tt.denyServer)
+			}
+		})
+	}
+}
+
+func TestJWKSFromURL(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	var jwks atomic.Value
+	jwks.Store(testJWKS(t, testJWK(t, "old", oldKey)))
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwks.Load().([]byte))
+	}))
+	defer ts.Close()
+
+	auth, err := NewAuthenticator(&AuthConfig{JWT: &JWTConfig{JWKSURL: ts.URL}})
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	now := time.Now()
+	auth.jwt.keys.now = func() time.Time { return now }
+
+	authenticate := func(token string) (*Caller, error) {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return auth.Authenticate(req)
+	}
+
+	claims := jwt.MapClaims{"sub": "alice", "exp": now.Add(time.Hour).Unix()}
+	if caller, err := authenticate(signTestToken(t, jwt.SigningMethodRS256, "old", oldKey, claims)); err != nil || caller.ID != "alice" {
+		t.Fatalf("expected token to be accepted, got %v, %v", caller, err)
+	}
+	if _, err := authenticate(signTestToken(t, jwt.SigningMethodRS256, "old", oldKey, claims)); err != nil {
+		t.Fatalf("expected token to be accepted, got %v", err)
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("expected keys to be cached, got %d fetches", fetches.Load())
+	}
+
+	// A rotated key is picked up once the refresh interval has passed
+	jwks.Store(testJWKS(t, testJWK(t, "old", oldKey), testJWK(t, "new", newKey)))
+	rotated := signTestToken(t, jwt.SigningMethodRS256, "new", newKey, claims)
+	if _, err := authenticate(rotated); err == nil {
+		t.Error("expected unknown key to be rejected within the refresh interval")
+	}
+	now = now.Add(2 * jwksMinRefreshInterval)
+	if _, err := authenticate(rotated); err != nil {
+		t.Errorf("expected rotated key to be accepted, got %v", err)
+	}
+	if fetches.Load() != 2 {
+		t.Errorf("expected 2 fetches, got %d", fetches.Load())
+	}
+
+	// Bearer tokens that are not JWTs are still looked up as API keys
+	if _, err := authenticate("not-a-jwt"); err == nil {
+		t.Error("expected unknown API key to be rejected")
+	}
+}
+
+func TestJWKSFetchDoesNotBlockKnownKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	jwks := testJWKS(t, testJWK(t, "k", key))
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		w.Write(jwks)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	validator, err := newJWTValidator(&JWTConfig{JWKSURL: ts.URL}, WithComponent("auth"))
+	if err != nil {
+		t.Fatalf("newJWTValidator failed: %v", err)
+	}
+	now := time.Now()
+	validator.keys.now = func() time.Time { return now }
+	token := signTestToken(t, jwt.SigningMethodRS256, "k", key, jwt.MapClaims{"sub": "alice", "exp": now.Add(time.Hour).Unix()})
+	if _, err := validator.validate(context.Background(), token); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	// The cached keys expire and the next fetch hangs
+	now = now.Add(2 * jwksCacheTTL)
+	go validator.validate(context.Background(), token)
+	for fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := validator.validate(context.Background(), token)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected the cached key to be used, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected validation with a known key not to wait for the fetch")
+	}
+}
+
+func TestJWKSFetchOutlivesCanceledRequest(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	jwks := testJWKS(t, testJWK(t, "k", key))
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		w.Write(jwks)
+	}))
+	defer ts.Close()
+
+	validator, err := newJWTValidator(&JWTConfig{JWKSURL: ts.URL}, WithComponent("auth"))
+	if err != nil {
+		t.Fatalf("newJWTValidator failed: %v", err)
+	}
+	token := signTestToken(t, jwt.SigningMethodRS256, "k", key, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+
+	// The first caller gives up while the keys are being fetched
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := validator.validate(ctx, token)
+		done <- err
+	}()
+	for fetches.Load() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err == nil {
+		t.Fatal("expected the canceled request to fail")
+	}
+
+	// The fetch still completes, and the next caller gets the keys from it
+	close(release)
+	if _, err := validator.validate(context.Background(), token); err != nil {
+		t.Errorf("expected the token to be accepted, got %v", err)
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("expected a single fetch, got %d", fetches.Load())
+	}
+}
+
+func TestNewJWTValidatorErrors(t *testing.T) {
+	badJWKS := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(badJWKS, []byte(`{"keys":[{"kty":"EC","kid":"k","crv":"P-256","x":"AA","y":"AA"}]}`), 0600); err != nil {
+		t.Fatalf("Failed to write JWKS file: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		config JWTConfig
+	}{
+		{name: "No key source", config: JWTConfig{}},
+		{name: "Both key sources", config: JWTConfig{JWKSURL: "https://example.com/jwks", JWKSFile: badJWKS}},
+		{name: "Missing JWKS file", config: JWTConfig{JWKSFile: filepath.Join(t.TempDir(), "missing")}},
+		{name: "Invalid key in JWKS", config: JWTConfig{JWKSFile: badJWKS}},
+		{name: "Invalid group tool pattern", config: JWTConfig{JWKSURL: "https://example.com/jwks", Groups: map[string]AccessScope{
+			"dev": {Tools: []string{"[invalid"}},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newJWTValidator(&tt.config, WithComponent("auth")); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -1,19 +1,266 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
+	"sync"
 )
 
-// InitLogger initializes the slog logger
-func InitLogger(level slog.Level) {
-	// Create JSON handler
-	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: level,
-	})
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+)
+
+type requestIDKey struct{}
+
+// logLevels holds the base log level and the per-component overrides. They
+// can be changed at runtime.
+type logLevels struct {
+	mu         sync.RWMutex
+	base       slog.Level
+	components map[string]slog.Level
+}
+
+// levels are the log levels of the default logger
+var levels = &logLevels{components: make(map[string]slog.Level)}
+
+// unfilteredHandler writes to the log output of the default logger without
+// checking the log levels. It is nil until InitLogger is called.
+var unfilteredHandler slog.Handler
+
+// enabled checks if records of the component at the level are logged
+func (l *logLevels) enabled(component string, level slog.Level) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if override, ok := l.components[component]; ok && component != "" {
+		return level >= override
+	}
+	return level >= l.base
+}
+
+// set replaces the base level and all component overrides
+func (l *logLevels) set(base slog.Level, components map[string]slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.base = base
+	l.components = make(map[string]slog.Level, len(components))
+	for name, level := range components {
+		l.components[name] = level
+	}
+}
+
+// update changes the base level if it is not nil, and the given component
+// overrides. A nil component level removes the override.
+func (l *logLevels) update(base *slog.Level, components map[string]*slog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if base != nil {
+		l.base = *base
+	}
+	for name, level := range components {
+		if level == nil {
+			delete(l.components, name)
+		} else {
+			l.components[name] = *level
+		}
+	}
+}
+
+// snapshot returns the base level and the component overrides
+func (l *logLevels) snapshot() (slog.Level, map[string]slog.Level) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	components := make(map[string]slog.Level, len(l.components))
+	for name, level := range l.components {
+		components[name] = level
+	}
+	return l.base, components
+}
+
+// InitLogger initializes the slog logger from the logging config. The
+// returned function closes the log file, if any.
+func InitLogger(cfg *LoggingConfig) (func() error, error) {
+	base, err := parseLogLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	components := make(map[string]slog.Level, len(cfg.Components))
+	for name, value := range cfg.Components {
+		level, err := parseLogLevel(value)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", name, err)
+		}
+		components[name] = level
+	}
+
+	var out io.Writer = os.Stdout
+	closeFn := func() error { return nil }
+	if cfg.File != "" {
+		file, err := newRotatingWriter(cfg.File, cfg.MaxSizeMB, cfg.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = file
+		closeFn = file.Close
+	}
+
+	// Levels are checked by the component level handler, so the output
+	// handler lets everything through
+	opts := &slog.HandlerOptions{Level: slog.Level(-8)}
+	var handler slog.Handler
+	switch cfg.Format {
+	case "", logFormatJSON:
+		handler = slog.NewJSONHandler(out, opts)
+	case logFormatText:
+		handler = slog.NewTextHandler(out, opts)
+	default:
+		closeFn()
+		return nil, fmt.Errorf("invalid log format %q", cfg.Format)
+	}
+
+	levels.set(base, components)
 
 	// Set default logger
-	slog.SetDefault(slog.New(handler))
+	unfilteredHandler = newContextHandler(handler)
+	slog.SetDefault(slog.New(newContextHandler(newComponentLevelHandler(handler, levels))))
+	return closeFn, nil
+}
+
+// parseLogLevel parses a level name like "debug" or "warning". An empty
+// name is the info level.
+func parseLogLevel(name string) (slog.Level, error) {
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	level, ok := parseLevelName(name)
+	if !ok {
+		return 0, fmt.Errorf("invalid log level %q", name)
+	}
+	return level, nil
+}
+
+// ParseComponentLevels parses overrides like "mcp_client=debug,server=info"
+func ParseComponentLevels(s string) (map[string]string, error) {
+	components := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, level, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid component level %q, expected component=level", pair)
+		}
+		if _, err := parseLogLevel(strings.TrimSpace(level)); err != nil {
+			return nil, err
+		}
+		components[strings.TrimSpace(name)] = strings.TrimSpace(level)
+	}
+	return components, nil
+}
+
+// componentLevelHandler filters records by the level of the component of the logger
+type componentLevelHandler struct {
+	slog.Handler
+	levels    *logLevels
+	component string
+}
+
+func newComponentLevelHandler(handler slog.Handler, levels *logLevels) slog.Handler {
+	return componentLevelHandler{Handler: handler, levels: levels}
+}
+
+func (h componentLevelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.levels.enabled(h.component, level)
+}
+
+func (h componentLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	component := h.component
+	for _, attr := range attrs {
+		if attr.Key == "component" {
+			component = attr.Value.String()
+		}
+	}
+	return componentLevelHandler{Handler: h.Handler.WithAttrs(attrs), levels: h.levels, component: component}
+}
+
+func (h componentLevelHandler) WithGroup(name string) slog.Handler {
+	return componentLevelHandler{Handler: h.Handler.WithGroup(name), levels: h.levels, component: h.component}
+}
+
+// handleSetLevel handles the MCP logging/setLevel method by changing the
+// base log level of the proxy. The level applies to all callers, so only
+// requests with the admin token may change it.
+func (s *Server) handleSetLevel(ctx context.Context, admin bool, params map[string]interface{}) (interface{}, error) {
+	if !admin {
+		return nil, &rpcError{
+			code:    errCodeForbidden,
+			message: "Forbidden",
+			data:    map[string]interface{}{"reason": fmt.Sprintf("logging/setLevel requires the %s header", adminTokenHeader)},
+		}
+	}
+	name, _ := params["level"].(string)
+	level, ok := parseLevelName(name)
+	if name == "" || !ok {
+		return nil, &rpcError{
+			code:    -32602,
+			message: "Invalid params",
+			data:    map[string]interface{}{"reason": fmt.Sprintf("invalid log level %q", name)},
+		}
+	}
+	levels.update(&level, nil)
+	s.logger.InfoContext(ctx, "Log level changed", "level", strings.ToLower(level.String()))
+	return struct{}{}, nil
+}
+
+// levelNames returns the base level and component overrides as names
+func levelNames(l *logLevels) (string, map[string]string) {
+	base, components := l.snapshot()
+	names := make(map[string]string, len(components))
+	for name, level := range components {
+		names[name] = strings.ToLower(level.String())
+	}
+	return strings.ToLower(base.String()), names
+}
+
+// contextHandler adds the request ID of the context to the records logged
+// with the Context variants of the logger methods
+type contextHandler struct {
+	slog.Handler
+}
+
+func newContextHandler(handler slog.Handler) slog.Handler {
+	return contextHandler{Handler: handler}
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// withRequestID returns a context whose log records carry the request ID
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFromContext returns the request ID of ctx, or "" if there is none
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
 }
 
 // WithComponent creates a logger with component context
@@ -21,6 +268,15 @@ func WithComponent(component string) *slog.Logger {
 	return slog.With("component", component)
 }
 
+// WithUnfilteredComponent creates a logger with component context whose
+// records are written whatever the log levels are
+func WithUnfilteredComponent(component string) *slog.Logger {
+	if unfilteredHandler == nil {
+		return WithComponent(component)
+	}
+	return slog.New(unfilteredHandler).With("component", component)
+}
+
 // WithServer creates a logger with server name context
 func WithServer(serverName string) *slog.Logger {
 	return slog.With("server_name", serverName)
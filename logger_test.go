@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// captureLogs makes the default logger write JSON records to the returned
+// buffer until the test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(newContextHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// restoreLogLevels restores the log levels and the default logger when the test ends
+func restoreLogLevels(t *testing.T) {
+	t.Helper()
+	previous := slog.Default()
+	previousUnfiltered := unfilteredHandler
+	base, components := levels.snapshot()
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		unfilteredHandler = previousUnfiltered
+		levels.set(base, components)
+	})
+}
+
+func TestComponentLevelHandler(t *testing.T) {
+	var buf bytes.Buffer
+	lv := &logLevels{}
+	lv.set(slog.LevelInfo, map[string]slog.Level{"mcp_client": slog.LevelDebug, "server": slog.LevelError})
+	logger := slog.New(newComponentLevelHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.Level(-8)}), lv))
+
+	tests := []struct {
+		name      string
+		component string
+		level     slog.Level
+		logged    bool
+	}{
+		{name: "Base level", level: slog.LevelInfo, logged: true},
+		{name: "Below base level", level: slog.LevelDebug, logged: false},
+		{name: "Lowered component", component: "mcp_client", level: slog.LevelDebug, logged: true},
+		{name: "Raised component", component: "server", level: slog.LevelWarn, logged: false},
+		{name: "Raised component error", component: "server", level: slog.LevelError, logged: true},
+		{name: "Component without override", component: "main", level: slog.LevelDebug, logged: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			l := logger
+			if tt.component != "" {
+				l = logger.With("component", tt.component)
+			}
+			l.Log(context.Background(), tt.level, "message")
+			if logged := buf.Len() > 0; logged != tt.logged {
+				t.Errorf("logged = %v, want %v", logged, tt.logged)
+			}
+		})
+	}
+}
+
+func TestParseComponentLevels(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{name: "Empty", input: "", expected: map[string]string{}},
+		{name: "Pairs", input: "mcp_client=debug, server=info", expected: map[string]string{"mcp_client": "debug", "server": "info"}},
+		{name: "Missing level", input: "mcp_client", wantErr: true},
+		{name: "Missing component", input: "=debug", wantErr: true},
+		{name: "Invalid level", input: "server=loud", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseComponentLevels(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseComponentLevels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("ParseComponentLevels() = %v, want %v", got, tt.expected)
+			}
+			for name, level := range tt.expected {
+				if got[name] != level {
+					t.Errorf("ParseComponentLevels()[%s] = %q, want %q", name, got[name], level)
+				}
+			}
+		})
+	}
+}
+
+func TestInitLogger(t *testing.T) {
+	restoreLogLevels(t)
+
+	tests := []struct {
+		name    string
+		config  LoggingConfig
+		wantErr bool
+	}{
+		{name: "Invalid format", config: LoggingConfig{Format: "xml"}, wantErr: true},
+		{name: "Invalid level", config: LoggingConfig{Level: "loud"}, wantErr: true},
+		{name: "Invalid component level", config: LoggingConfig{Components: map[string]string{"server": "loud"}}, wantErr: true},
+		{name: "Defaults", config: LoggingConfig{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			closeLog, err := InitLogger(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InitLogger() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				closeLog()
+			}
+		})
+	}
+}
+
+func TestInitLoggerTextFile(t *testing.T) {
+	restoreLogLevels(t)
+	path := filepath.Join(t.TempDir(), "proxy.log")
+
+	closeLog, err := InitLogger(&LoggingConfig{
+		Format:     "text",
+		Level:      "warn",
+		Components: map[string]string{"mcp_client": "debug"},
+		File:       path,
+	})
+	if err != nil {
+		t.Fatalf("InitLogger failed: %v", err)
+	}
+	WithComponent("server").Info("hidden")
+	WithComponent("mcp_client").Debug("shown")
+	closeLog()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if strings.Contains(string(b), "hidden") || !strings.Contains(string(b), "msg=shown component=mcp_client") {
+		t.Errorf("unexpected log file contents:\n%s", b)
+	}
+}
+
+func TestSetLevelMethod(t *testing.T) {
+	restoreLogLevels(t)
+	levels.set(slog.LevelInfo, nil)
+	server := newScopedTestServer(t, false)
+	server.adminToken = "admin-secret"
+
+	tests := []struct {
+		name       string
+		adminToken string
+		level      string
+		code       int
+		expected   slog.Level
+	}{
+		{name: "Without admin token", level: "debug", code: errCodeForbidden, expected: slog.LevelInfo},
+		{name: "Wrong admin token", adminToken: "nope", level: "debug", code: errCodeForbidden, expected: slog.LevelInfo},
+		{name: "With admin token", adminToken: "admin-secret", level: "debug", expected: slog.LevelDebug},
+		{name: "Invalid level", adminToken: "admin-secret", level: "loud", code: -32602, expected: slog.LevelDebug},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"logging/setLevel","params":{"level":"`+tt.level+`"},"id":1}`))
+			req.Header.Set("X-API-Key", "limited-key")
+			if tt.adminToken != "" {
+				req.Header.Set(adminTokenHeader, tt.adminToken)
+			}
+			w := httptest.NewRecorder()
+			server.handleJSONRPC(w, req)
+
+			var resp JSONRPCResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to parse response %q: %v", w.Body.String(), err)
+			}
+			switch {
+			case tt.code == 0 && resp.Error != nil:
+				t.Errorf("expected success, got %+v", resp.Error)
+			case tt.code != 0 && (resp.Error == nil || resp.Error.Code != tt.code):
+				t.Errorf("expected error code %d, got %+v", tt.code, resp)
+			}
+			if base, _ := levels.snapshot(); base != tt.expected {
+				t.Errorf("expected level %v, got %v", tt.expected, base)
+			}
+		})
+	}
+}
+
+func TestAuditRecordsIgnoreLogLevels(t *testing.T) {
+	restoreLogLevels(t)
+	path := filepath.Join(t.TempDir(), "proxy.log")
+
+	closeLog, err := InitLogger(&LoggingConfig{Level: "error", Components: map[string]string{"audit": "error"}, File: path})
+	if err != nil {
+		t.Fatalf("InitLogger failed: %v", err)
+	}
+	audit, err := NewAuditLogger(&AuditConfig{}, nil)
+	if err != nil {
+		t.Fatalf("NewAuditLogger failed: %v", err)
+	}
+	audit.record(withRequestID(context.Background(), "req-1"), "a", "search", nil, mcp.NewToolResultText("ok"), nil, time.Millisecond)
+	WithComponent("audit").Info("hidden")
+	closeLog()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if strings.Contains(string(b), "hidden") || !strings.Contains(string(b), `"msg":"Tool call"`) || !strings.Contains(string(b), `"request_id":"req-1"`) {
+		t.Errorf("expected only the audit record with its request ID, got:\n%s", b)
+	}
+}
+
+func TestContextHandler(t *testing.T) {
+	buf := captureLogs(t)
+	logger := WithComponent("test")
+
+	logger.InfoContext(withRequestID(context.Background(), "req-1"), "with id")
+	logger.InfoContext(context.Background(), "without id")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %d", len(lines))
+	}
+	var first, second map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &first)
+	json.Unmarshal([]byte(lines[1]), &second)
+	if first["request_id"] != "req-1" || first["component"] != "test" {
+		t.Errorf("expected request_id and component, got %v", first)
+	}
+	if _, ok := second["request_id"]; ok {
+		t.Errorf("expected no request_id, got %v", second)
+	}
+}
+
+func TestRequestIDFromHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "Taken from the header", header: "abc-123", expected: "abc-123"},
+		{name: "Generated if missing", header: ""},
+		{name: "Generated if it has spaces", header: "abc 123"},
+		{name: "Generated if it has control characters", header: "abc\x01"},
+		{name: "Generated if too long", header: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.header != "" {
+				header.Set("X-Request-Id", tt.header)
+			}
+			got := requestIDFromHeader(header)
+			if tt.expected != "" && got != tt.expected {
+				t.Errorf("requestIDFromHeader() = %q, want %q", got, tt.expected)
+			}
+			if tt.expected == "" && (len(got) != 32 || got == tt.header) {
+				t.Errorf("expected a generated ID, got %q", got)
+			}
+		})
+	}
+}
+
+func TestRequestIDCorrelation(t *testing.T) {
+	buf := captureLogs(t)
+	server := newScopedTestServer(t, false)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"tools/call","params":{"name":"delete_issue"},"id":1}`))
+	req.Header.Set("X-API-Key", "limited-key")
+	req.Header.Set("X-Request-Id", "trace-me")
+	w := httptest.NewRecorder()
+	server.handleJSONRPC(w, req)
+
+	if got := w.Header().Get("X-Request-Id"); got != "trace-me" {
+		t.Errorf("expected the request ID in the response header, got %q", got)
+	}
+	var resp JSONRPCResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	data, _ := resp.Error.Data.(map[string]interface{})
+	if data["requestId"] != "trace-me" || data["reason"] == nil {
+		t.Errorf("expected the request ID in the error data, got %v", resp.Error.Data)
+	}
+
+	var correlated int
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		json.Unmarshal([]byte(line), &record)
+		if record["request_id"] == "trace-me" {
+			correlated++
+		}
+	}
+	// Processing, denial by access scope and the error response
+	if correlated < 3 {
+		t.Errorf("expected the request's log records to carry its ID, got %d in:\n%s", correlated, buf.String())
+	}
+}
+
+func TestErrorData(t *testing.T) {
+	ctx := withRequestID(context.Background(), "r1")
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		data     interface{}
+		expected string
+	}{
+		{name: "No request ID", ctx: context.Background(), data: "x", expected: `"x"`},
+		{name: "No data", ctx: ctx, data: nil, expected: `{"requestId":"r1"}`},
+		{name: "Object data", ctx: ctx, data: map[string]interface{}{"reason": "no"}, expected: `{"reason":"no","requestId":"r1"}`},
+		{name: "Other data", ctx: ctx, data: "boom", expected: `{"detail":"boom","requestId":"r1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := json.Marshal(errorData(tt.ctx, tt.data))
+			if string(got) != tt.expected {
+				t.Errorf("errorData() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
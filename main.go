@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -20,14 +21,29 @@ func main() {
 	debug := flag.Bool("debug", false, "enable debug mode")
 	splitMode := flag.Bool("split", false, "enable split mode (separate endpoints per MCP server)")
 	initTimeoutSec := flag.Int("init-timeout", 60, "timeout in seconds for each MCP client initialization")
+	tlsCert := flag.String("tls-cert", "", "path to TLS certificate file (enables HTTPS)")
+	tlsKey := flag.String("tls-key", "", "path to TLS private key file")
+	clientCA := flag.String("client-ca", "", "path to CA certificate file for verifying client certificates (enables mTLS)")
+	watchConfig := flag.Bool("watch-config", false, "reload the config when the file changes (it is always reloaded on SIGHUP)")
+	logFormat := flag.String("log-format", "", "log format: json or text (default json)")
+	logLevel := flag.String("log-level", "", "log level: debug, info, warn or error (default info)")
+	logFile := flag.String("log-file", "", "path to log file, rotated by size (default stdout)")
+	logComponents := flag.String("log-components", "", "per-component log levels like mcp_client=debug,server=info")
 	flag.Parse()
 
-	// Initialize logger with level
-	logLevel := slog.LevelInfo
-	if *debug {
-		logLevel = slog.LevelDebug
+	// Initialize logger from the flags until the config is loaded
+	if *debug && *logLevel == "" {
+		*logLevel = "debug"
+	}
+	components, err := ParseComponentLevels(*logComponents)
+	if err != nil {
+		slog.Error("Invalid -log-components flag", "error", err)
+		os.Exit(1)
+	}
+	if _, err := InitLogger(&LoggingConfig{Format: *logFormat, Level: *logLevel, Components: components}); err != nil {
+		slog.Error("Failed to initialize logger", "error", err)
+		os.Exit(1)
 	}
-	InitLogger(logLevel)
 	logger := WithComponent("main")
 
 	// Load dotenv if it exists
@@ -48,69 +64,201 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Reinitialize logger with the logging config; flags take precedence
+	logCfg := LoggingConfig{}
+	if cfg.Logging != nil {
+		logCfg = *cfg.Logging
+	}
+	if *logFormat != "" {
+		logCfg.Format = *logFormat
+	}
+	if *logLevel != "" {
+		logCfg.Level = *logLevel
+	}
+	if *logFile != "" {
+		logCfg.File = *logFile
+	}
+	if len(components) > 0 {
+		merged := make(map[string]string, len(logCfg.Components)+len(components))
+		for name, level := range logCfg.Components {
+			merged[name] = level
+		}
+		for name, level := range components {
+			merged[name] = level
+		}
+		logCfg.Components = merged
+	}
+	closeLog, err := InitLogger(&logCfg)
+	if err != nil {
+		logger.Error("Failed to initialize logger", "error", err)
+		os.Exit(1)
+	}
+	defer closeLog()
+	logger = WithComponent("main")
+
+	if cfg.Tracing != nil {
+		shutdownTracing, err := SetupTracing(cfg.Tracing)
+		if err != nil {
+			logger.Error("Failed to set up tracing", "error", err)
+			os.Exit(1)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				logger.Error("Failed to flush traces", "error", err)
+			}
+		}()
+	}
+
+	serverOpts := []ServerOption{
+		WithIdentityHeader(cfg.IdentityHeader),
+		WithMaxRequestBytes(cfg.MaxRequestBytes),
+		WithInitTimeout(time.Duration(*initTimeoutSec) * time.Second),
+	}
+	var redactor *Redactor
+	if cfg.Redaction != nil {
+		redactor, err = NewRedactor(cfg.Redaction)
+		if err != nil {
+			logger.Error("Failed to set up redaction", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, WithRedactor(redactor))
+	}
+	if cfg.Auth != nil {
+		authenticator, err := NewAuthenticator(cfg.Auth)
+		if err != nil {
+			logger.Error("Failed to set up authentication", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, WithAuthenticator(authenticator))
+	}
+	if cfg.Policy != nil {
+		policy, err := NewPolicyEngine(cfg.Policy)
+		if err != nil {
+			logger.Error("Failed to set up policy", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, WithPolicy(policy))
+	}
+	if cfg.Approval != nil {
+		approvals, err := NewApprovalManager(cfg.Approval, redactor)
+		if err != nil {
+			logger.Error("Failed to set up approvals", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, WithApprovals(approvals))
+	}
+	if cfg.RateLimits != nil {
+		serverOpts = append(serverOpts, WithRateLimiter(NewRateLimiter(cfg.RateLimits)))
+	}
+	if cfg.Audit != nil {
+		audit, err := NewAuditLogger(cfg.Audit, redactor)
+		if err != nil {
+			logger.Error("Failed to set up audit log", "error", err)
+			os.Exit(1)
+		}
+		defer audit.Close()
+		serverOpts = append(serverOpts, WithAuditLogger(audit))
+	}
+	if cfg.Admin != nil {
+		token, err := adminToken(cfg.Admin)
+		if err != nil {
+			logger.Error("Failed to set up admin API", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, WithAdminToken(token), WithRecentCalls(cfg.Admin.RecentCalls))
+	}
+	if cfg.Health != nil {
+		healthPolicy, err := NewHealthPolicy(cfg.Health)
+		if err != nil {
+			logger.Error("Failed to set up health checks", "error", err)
+			os.Exit(1)
+		}
+		for _, name := range cfg.Health.RequiredServers {
+			if _, ok := cfg.MCPServers[name]; !ok {
+				logger.Error("Failed to set up health checks", "error", "unknown required server "+name)
+				os.Exit(1)
+			}
+		}
+		serverOpts = append(serverOpts, WithHealthPolicy(healthPolicy))
+	}
+	if *tlsCert != "" || *tlsKey != "" || *clientCA != "" {
+		tlsConfig, err := newServerTLSConfig(*tlsCert, *tlsKey, *clientCA)
+		if err != nil {
+			logger.Error("Failed to set up TLS", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, WithTLS(tlsConfig))
+	}
+
 	// Create empty MCP clients map and start server immediately
-	server := NewServer(make(map[string]*MCPClient), *splitMode)
+	server := NewServer(make(map[string]*MCPClient), *splitMode, serverOpts...)
 
 	// Create context for graceful shutdown
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	// Reload the config on SIGHUP once the clients are initialized
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	// The watcher and SIGHUP may reload at the same time. Changed sections
+	// are reported against the last loaded config, so that each change is
+	// reported once.
+	var reloadMu sync.Mutex
+	lastLoaded := cfg
+	reload := func(reason string) {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		logger.Info("Reloading config", "reason", reason)
+		loaded, err := LoadConfig(*configPath)
+		if err != nil {
+			logger.Error("Failed to reload config; keeping the running servers", "error", err)
+			return
+		}
+		if changed := changedSections(lastLoaded, loaded); len(changed) > 0 {
+			logger.Warn("Config changes outside mcpServers take effect on restart", "sections", changed)
+		}
+		lastLoaded = loaded
+		server.ReloadClients(ctx, MCPClientConfigs(loaded))
+		logger.Info("Config reloaded")
+	}
+
 	// Start server in a goroutine
-	errCh := make(chan error, 1)
+	errCh := make(chan error, 2)
 	go func() {
 		errCh <- server.Start(*port)
 	}()
+	if cfg.Admin != nil {
+		go func() {
+			errCh <- server.StartAdmin(adminListen(cfg.Admin))
+		}()
+	}
+
+	go server.RunHealthChecks(ctx)
 
 	// Initialize MCP clients asynchronously
 	go func() {
 		logger.Info("Starting MCP client initialization")
-		tempMcpClients := make(map[string]*MCPClient)
-		for name, serverCfg := range cfg.MCPServers {
-			if serverCfg.Extensions != nil && serverCfg.Extensions.Disabled {
-				logger.Info("Skipping disabled MCP server", "server_name", name)
-				continue
-			}
-
-			mcpCfg := ConvertToMCPClientConfig(serverCfg)
-			client, err := NewMCPClient(mcpCfg)
-			if err != nil {
-				logger.Error("Failed to create MCP client",
-					"server_name", name,
-					"error", err)
-				continue
-			}
-
-			err = withTimeout(ctx, time.Duration(*initTimeoutSec)*time.Second, func(timeoutCtx context.Context) error {
-				_, err := client.Initialize(ctx)
-				return err
-			})
-			if err != nil {
-				logger.Error("Failed to initialize MCP client", "server_name", name, "error", err)
-				continue
-			}
-
-			tempMcpClients[name] = client
-			logger.Info("MCP Server initialized successfully", "server_name", name)
+		server.StartClients(ctx, MCPClientConfigs(cfg))
+		logger.Info("MCP client initialization completed; Now its ready")
 
-			// Log environment variables checksums if in debug mode
-			if *debug {
-				LogConfig(logger, name, serverCfg.Env)
+		if *watchConfig {
+			go watchConfigFile(ctx, *configPath, defaultConfigWatchInterval, func() { reload("file changed") })
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reloadCh:
+				reload("SIGHUP")
 			}
 		}
-
-		// Update server's mcpClients map atomically with initMu lock
-		server.initMu.Lock()
-		server.mcpClients = tempMcpClients
-		server.initMu.Unlock()
-		logger.Info("MCP client initialization completed; Now its ready")
 	}()
 
 	// Add cleanup for MCP clients on shutdown
 	defer func() {
-		server.initMu.RLock()
-		defer server.initMu.RUnlock()
-		mcpClients := server.mcpClients
-		for _, client := range mcpClients {
+		for _, client := range server.clients() {
 			client.Close()
 		}
 	}()
@@ -132,10 +280,3 @@ func main() {
 		}
 	}
 }
-
-func withTimeout(parentCtx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
-	ctx, cancel := context.WithTimeout(parentCtx, timeout)
-	defer cancel()
-
-	return fn(ctx)
-}
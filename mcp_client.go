@@ -3,13 +3,18 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // MCPClient provides an interface to external MCP servers
@@ -18,8 +23,28 @@ type MCPClient struct {
 	client       *client.Client
 	logger       *slog.Logger
 	stderrCancel context.CancelFunc
-	initOnce     sync.Once // Ensures monitoring starts only once during Initialize
-	closeOnce    sync.Once // Ensures close operation is performed only once
+	stderrDone   chan struct{} // Closed when the stderr capture returns
+	stderrMu     sync.Mutex    // Guards stderrCancel and stderrDone, set while Close may run
+	initOnce     sync.Once     // Ensures monitoring starts only once during Initialize
+	closeOnce    sync.Once     // Ensures close operation is performed only once
+	breaker      *circuitBreaker
+	limiter      *concurrencyLimiter
+	rateLimits   *serverRateLimits
+	outputFilter *serverOutputFilters
+	resultLimits *serverResultLimits
+	stderr       *stderrBuffer
+
+	// When Initialize succeeded
+	startedAt time.Time
+	health    *clientHealth
+	// Applied to upstream errors before they are logged
+	redactor *Redactor
+
+	// Tools annotated by the server as idempotent or read-only, used for the retry policy
+	idempotentTools map[string]bool
+	// Tools the server published in its last tool list, after the allow/deny lists
+	knownTools   map[string]bool
+	idempotentMu sync.RWMutex
 }
 
 // NewMCPClient creates a new MCP client
@@ -30,19 +55,53 @@ func NewMCPClient(config *MCPClientConfig) (*MCPClient, error) {
 		env = append(env, fmt.Sprintf("%s=%s", k, v))
 	}
 
+	outputFilter, err := newServerOutputFilters(config.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output filter: %w", err)
+	}
+	resultLimits, err := newServerResultLimits(config.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid result limit: %w", err)
+	}
+
+	if err := validateStderrExtensions(config.Extensions); err != nil {
+		return nil, err
+	}
+	logger := WithComponent("mcp_client")
+	if config.Name != "" {
+		logger = WithComponentAndServer("mcp_client", config.Name)
+	}
+	mcpClient := &MCPClient{
+		config:       config,
+		logger:       logger,
+		limiter:      newConcurrencyLimiter(config.Extensions, logger),
+		rateLimits:   newServerRateLimits(config.Extensions),
+		outputFilter: outputFilter,
+		resultLimits: resultLimits,
+		stderr:       newStderrBuffer(stderrBufferLines(config.Extensions)),
+		health:       newClientHealth(),
+	}
+	if config.Extensions != nil {
+		mcpClient.breaker = newCircuitBreaker(config.Extensions.CircuitBreaker, logger)
+	}
+
 	var c *client.Client
-	var err error
 	if config.Command != "" {
-		c, err = client.NewStdioMCPClient(
-			config.Command,
-			env,
-			config.Args...,
-		)
+		// NewStdioMCPClient would spawn the subprocess here, and Initialize
+		// would spawn it again
+		c = client.NewClient(transport.NewStdio(config.Command, env, config.Args...))
 	} else if config.Url != "" {
+		httpClient := newUpstreamHTTPClient(config, logger)
 		if config.Extensions != nil && config.Extensions.Sse {
-			c, err = client.NewSSEMCPClient(config.Url)
+			c, err = client.NewSSEMCPClient(config.Url,
+				client.WithHeaders(config.Headers),
+				client.WithHeaderFunc(mcpClient.forwardedHeaders),
+				client.WithHTTPClient(httpClient))
 		} else {
-			c, err = client.NewStreamableHttpClient(config.Url)
+			c, err = client.NewStreamableHttpClient(config.Url,
+				transport.WithHTTPHeaders(config.Headers),
+				transport.WithHTTPHeaderFunc(mcpClient.forwardedHeaders),
+				transport.WithHTTPBasicClient(httpClient))
 		}
 	} else {
 		return nil, fmt.Errorf("no MCP transport specified")
@@ -51,27 +110,28 @@ func NewMCPClient(config *MCPClientConfig) (*MCPClient, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create MCP client: %w", err)
 	}
+	mcpClient.client = c
 
-	return &MCPClient{
-		config: config,
-		client: c,
-		logger: WithComponent("mcp_client"),
-	}, nil
+	return mcpClient, nil
 }
 
 func (c *MCPClient) Initialize(ctx context.Context) (*mcp.InitializeResult, error) {
-	// Start stderr monitoring once when Initialize is successful
+	if err := c.client.Start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start client: %w", err)
+	}
+
+	// Start stderr monitoring once the subprocess is started
 	c.initOnce.Do(func() {
 		stderrCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		c.stderrMu.Lock()
 		c.stderrCancel = cancel
-		go c.captureStderr(stderrCtx)
+		c.stderrDone = done
+		c.stderrMu.Unlock()
+		go c.captureStderr(stderrCtx, done)
 		c.logger.Debug("stderr capture goroutine started")
 	})
 
-	if err := c.client.Start(ctx); err != nil {
-		return nil, fmt.Errorf("failed to start client: %w", err)
-	}
-
 	initRequest := mcp.InitializeRequest{}
 	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
 	initRequest.Params.ClientInfo = mcp.Implementation{
@@ -83,11 +143,13 @@ func (c *MCPClient) Initialize(ctx context.Context) (*mcp.InitializeResult, erro
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize: %w", err)
 	}
+	c.startedAt = time.Now()
 
 	return resp, nil
 }
 
-func (c *MCPClient) captureStderr(ctx context.Context) {
+func (c *MCPClient) captureStderr(ctx context.Context, done chan struct{}) {
+	defer close(done)
 	stderr, ok := client.GetStderr(c.client)
 	if !ok {
 		c.logger.Debug("stderr not available for this client type")
@@ -108,21 +170,43 @@ func (c *MCPClient) captureStderr(ctx context.Context) {
 				}
 				return // Exit on error or EOF
 			}
-			line := scanner.Text()
-			c.logger.Warn("subprocess stderr", "message", line)
+			c.logStderr(scanner.Text())
 		}
 	}
 }
 
+// waitStderr waits up to timeout until the stderr of the subprocess is read to
+// the end, so that the last lines of a subprocess that exited are kept when
+// the client is closed
+func (c *MCPClient) waitStderr(timeout time.Duration) {
+	c.stderrMu.Lock()
+	done := c.stderrDone
+	c.stderrMu.Unlock()
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
 func (c *MCPClient) ListTools(ctx context.Context) ([]mcp.Tool, error) {
 	req := mcp.ListToolsRequest{}
-	resp, err := c.client.ListTools(ctx, req)
+	var resp *mcp.ListToolsResult
+	err := c.withResilience(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.client.ListTools(ctx, req)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list tools: %w", err)
 	}
+	c.recordIdempotentTools(resp.Tools)
 
 	// Skip filtering if no extensions are configured
 	if c.config.Extensions == nil {
+		c.recordKnownTools(resp.Tools)
 		return resp.Tools, nil
 	}
 
@@ -134,28 +218,185 @@ func (c *MCPClient) ListTools(ctx context.Context) ([]mcp.Tool, error) {
 		}
 	}
 
+	c.recordKnownTools(filteredTools)
 	return filteredTools, nil
 }
 
 func (c *MCPClient) CallTool(ctx context.Context, name string, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	ctx, span := tracer().Start(withToolCall(ctx), "tools/call "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrMCPMethod.String("tools/call"), attrMCPTool.String(name)))
+	defer span.End()
+
+	result, err := c.callTool(ctx, name, args)
+	endSpan(span, result, err)
+	return result, err
+}
+
+// callTool calls the tool with the configured limits and retry policy
+func (c *MCPClient) callTool(ctx context.Context, name string, args map[string]interface{}) (*mcp.CallToolResult, error) {
 	// Check tool restrictions
 	if c.config.Extensions != nil && !c.isToolAllowed(name) {
 		logger := WithComponent("mcp_client")
-		logger.Warn("Tool access denied", "tool", name)
+		logger.WarnContext(ctx, "Tool access denied", "tool", name)
 		return nil, fmt.Errorf("tool %s is not allowed", name)
 	}
 
+	if c.limiter != nil {
+		release, err := c.limiter.acquire(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to call tool: %w", err)
+		}
+		defer release()
+	}
+
 	req := mcp.CallToolRequest{}
 	req.Params.Name = name
 	req.Params.Arguments = args
+	meta := c.callerMeta(ctx)
+	for k, v := range traceMeta(ctx) {
+		if meta == nil {
+			meta = make(map[string]interface{})
+		}
+		meta[k] = v
+	}
+	if meta != nil {
+		req.Params.Meta = &mcp.Meta{AdditionalFields: meta}
+	}
+
+	attempts := 1
+	if c.isRetryable(name) {
+		attempts = c.config.Extensions.Retry.maxAttempts()
+	}
 
-	resp, err := c.client.CallTool(ctx, req)
+	var resp *mcp.CallToolResult
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = c.withResilience(ctx, func(ctx context.Context) error {
+			var err error
+			resp, err = c.client.CallTool(ctx, req)
+			return err
+		})
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !isTransient(err) {
+			break
+		}
+
+		backoff := c.config.Extensions.Retry.backoff(attempt)
+		c.logger.WarnContext(ctx, "Retrying tool call",
+			"tool", name,
+			"attempt", attempt+1,
+			"backoff", backoff.String(),
+			"error", c.redactor.redactString(err.Error()))
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to call tool: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to call tool: %w", err)
 	}
 	return resp, nil
 }
 
+// Ping checks that the server responds
+func (c *MCPClient) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx)
+}
+
+// withResilience runs a single upstream request with the configured timeout,
+// guarded by the circuit breaker if one is configured
+func (c *MCPClient) withResilience(ctx context.Context, fn func(ctx context.Context) error) error {
+	if c.breaker != nil {
+		if retryAfter, ok := c.breaker.allow(); !ok {
+			return newCircuitOpenError(retryAfter)
+		}
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, c.requestTimeout())
+	defer cancel()
+
+	err := fn(reqCtx)
+	if c.breaker != nil {
+		// A JSON-RPC error response, e.g. for invalid arguments, comes from a
+		// healthy server
+		outcome := err
+		if err != nil && !errors.Is(err, context.Canceled) && !isTransient(err) {
+			outcome = nil
+		}
+		c.breaker.done(outcome)
+	}
+	return err
+}
+
+// requestTimeout returns the timeout for a single request to the server
+func (c *MCPClient) requestTimeout() time.Duration {
+	if c.config.Extensions != nil && c.config.Extensions.Timeout > 0 {
+		return time.Duration(c.config.Extensions.Timeout)
+	}
+	return defaultRequestTimeout
+}
+
+// isTransient checks if a failed request may succeed when repeated. mcp-go
+// reports connection errors and 5xx responses as transport errors, while
+// JSON-RPC error responses of the server carry only their message and are
+// final. An open circuit is not transient either.
+func isTransient(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || strings.HasPrefix(err.Error(), "transport error")
+}
+
+// isRetryable checks if failed calls of the tool may be retried.
+// Only tools that are safe to repeat are retried.
+func (c *MCPClient) isRetryable(toolName string) bool {
+	if c.config.Extensions == nil || c.config.Extensions.Retry == nil {
+		return false
+	}
+
+	for _, tool := range c.config.Extensions.Retry.Tools {
+		if tool == toolName {
+			return true
+		}
+	}
+
+	c.idempotentMu.RLock()
+	defer c.idempotentMu.RUnlock()
+	return c.idempotentTools[toolName]
+}
+
+// recordIdempotentTools remembers which tools the server annotates as safe to repeat
+func (c *MCPClient) recordIdempotentTools(tools []mcp.Tool) {
+	idempotent := make(map[string]bool)
+	for _, tool := range tools {
+		hints := tool.Annotations
+		if (hints.IdempotentHint != nil && *hints.IdempotentHint) || (hints.ReadOnlyHint != nil && *hints.ReadOnlyHint) {
+			idempotent[tool.Name] = true
+		}
+	}
+
+	c.idempotentMu.Lock()
+	c.idempotentTools = idempotent
+	c.idempotentMu.Unlock()
+}
+
+// recordKnownTools remembers the tools the server publishes
+func (c *MCPClient) recordKnownTools(tools []mcp.Tool) {
+	known := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		known[tool.Name] = true
+	}
+
+	c.idempotentMu.Lock()
+	c.knownTools = known
+	c.idempotentMu.Unlock()
+}
+
+// knowsTool checks if the server published the tool in its last tool list
+func (c *MCPClient) knowsTool(toolName string) bool {
+	c.idempotentMu.RLock()
+	defer c.idempotentMu.RUnlock()
+	return c.knownTools[toolName]
+}
+
 // isToolAllowed checks if the tool is allowed to be called
 func (c *MCPClient) isToolAllowed(toolName string) bool {
 	ext := c.config.Extensions
@@ -190,11 +431,13 @@ func (c *MCPClient) isToolAllowed(toolName string) bool {
 func (c *MCPClient) Close() error {
 	var err error
 	c.closeOnce.Do(func() {
+		c.stderrMu.Lock()
 		if c.stderrCancel != nil {
 			c.logger.Debug("cancelling stderr capture")
 			c.stderrCancel()
 			c.stderrCancel = nil // Prevent being called again
 		}
+		c.stderrMu.Unlock()
 
 		c.logger.Debug("closing underlying stdio client")
 		err = c.client.Close()
@@ -1,9 +1,67 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
 )
 
+// newInProcessMCPClient creates an initialized MCPClient connected to an in-process MCP server
+func newInProcessMCPClient(t *testing.T, config *MCPClientConfig, tools ...mcpserver.ServerTool) *MCPClient {
+	t.Helper()
+
+	srv := mcpserver.NewMCPServer("test-server", "1.0.0", mcpserver.WithToolCapabilities(false))
+	srv.AddTools(tools...)
+
+	c, err := client.NewInProcessClient(srv)
+	if err != nil {
+		t.Fatalf("Failed to create in-process client: %v", err)
+	}
+
+	logger := WithComponent("mcp_client")
+	var breaker *circuitBreaker
+	if config.Extensions != nil {
+		breaker = newCircuitBreaker(config.Extensions.CircuitBreaker, logger)
+	}
+	outputFilter, err := newServerOutputFilters(config.Extensions)
+	if err != nil {
+		t.Fatalf("Invalid output filter: %v", err)
+	}
+	resultLimits, err := newServerResultLimits(config.Extensions)
+	if err != nil {
+		t.Fatalf("Invalid result limit: %v", err)
+	}
+	mcpClient := &MCPClient{
+		config:       config,
+		client:       c,
+		logger:       logger,
+		breaker:      breaker,
+		limiter:      newConcurrencyLimiter(config.Extensions, logger),
+		rateLimits:   newServerRateLimits(config.Extensions),
+		outputFilter: outputFilter,
+		resultLimits: resultLimits,
+		health:       newClientHealth(),
+	}
+	if _, err := mcpClient.Initialize(context.Background()); err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+	t.Cleanup(func() { mcpClient.Close() })
+	return mcpClient
+}
+
 func TestIsToolAllowed(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -185,3 +243,317 @@ func TestIsToolAllowed(t *testing.T) {
 		})
 	}
 }
+
+// newFlakyUpstream returns the URL of an HTTP MCP server with the tools
+// whose first failures tool calls fail with 503. calls counts the tool calls.
+func newFlakyUpstream(t *testing.T, failures int32, calls *int32, tools ...mcpserver.ServerTool) string {
+	t.Helper()
+	srv := mcpserver.NewMCPServer("flaky", "1.0.0", mcpserver.WithToolCapabilities(false))
+	srv.AddTools(tools...)
+	handler := mcpserver.NewStreamableHTTPServer(srv)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if bytes.Contains(body, []byte(`"tools/call"`)) {
+			if n := atomic.AddInt32(calls, 1); n <= failures {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestCallToolRetry(t *testing.T) {
+	retry := &RetryExtensions{
+		MaxAttempts:    3,
+		InitialBackoff: Duration(time.Millisecond),
+		Tools:          []string{"search"},
+	}
+	tool := func(name string, opts ...mcp.ToolOption) []mcpserver.ServerTool {
+		return []mcpserver.ServerTool{{
+			Tool: mcp.NewTool(name, opts...),
+			Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return mcp.NewToolResultText("ok"), nil
+			},
+		}}
+	}
+
+	tests := []struct {
+		name          string
+		tools         []mcpserver.ServerTool
+		call          string
+		failures      int32
+		listFirst     bool
+		expectedCalls int32
+		expectErr     bool
+	}{
+		{
+			name:          "Idempotent tool from config is retried",
+			tools:         tool("search"),
+			call:          "search",
+			failures:      2,
+			expectedCalls: 3,
+		},
+		{
+			name:          "Non-idempotent tool is not retried",
+			tools:         tool("create"),
+			call:          "create",
+			failures:      1,
+			expectedCalls: 1,
+			expectErr:     true,
+		},
+		{
+			name:          "Tool annotated as idempotent is retried",
+			tools:         tool("get", mcp.WithIdempotentHintAnnotation(true)),
+			call:          "get",
+			failures:      1,
+			listFirst:     true,
+			expectedCalls: 2,
+		},
+		{
+			name:          "Retries stop after max attempts",
+			tools:         tool("search"),
+			call:          "search",
+			failures:      5,
+			expectedCalls: 3,
+			expectErr:     true,
+		},
+		{
+			// The server answers with -32602 for unknown tools
+			name:          "JSON-RPC errors are not retried",
+			call:          "search",
+			expectedCalls: 1,
+			expectErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			url := newFlakyUpstream(t, tt.failures, &calls, tt.tools...)
+			c, err := NewMCPClient(&MCPClientConfig{Url: url, Extensions: &Extensions{Retry: retry}})
+			if err != nil {
+				t.Fatalf("NewMCPClient failed: %v", err)
+			}
+			defer c.Close()
+			if _, err := c.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			if tt.listFirst {
+				if _, err := c.ListTools(context.Background()); err != nil {
+					t.Fatalf("ListTools failed: %v", err)
+				}
+			}
+
+			_, err = c.CallTool(context.Background(), tt.call, nil)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("CallTool error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.expectedCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.expectedCalls, got)
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "Transport error", err: fmt.Errorf("transport error: %w", errors.New("connection refused")), expected: true},
+		{name: "Request timeout", err: fmt.Errorf("transport error: %w", context.DeadlineExceeded), expected: true},
+		{name: "Deadline", err: context.DeadlineExceeded, expected: true},
+		{name: "JSON-RPC error", err: errors.New("tool 'search' not found: tool not found")},
+		{name: "Open circuit", err: newCircuitOpenError(time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.expected {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCallToolCircuitBreaker(t *testing.T) {
+	search := mcpserver.ServerTool{
+		Tool: mcp.NewTool("search"),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("ok"), nil
+		},
+	}
+
+	tests := []struct {
+		name          string
+		call          string
+		failures      int32
+		expectedCalls int32
+		expectOpen    bool
+	}{
+		{name: "Transport errors open the circuit", call: "search", failures: 100, expectedCalls: 2, expectOpen: true},
+		// The server answers with -32602 for unknown tools
+		{name: "JSON-RPC errors keep the circuit closed", call: "missing", expectedCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			url := newFlakyUpstream(t, tt.failures, &calls, search)
+			c, err := NewMCPClient(&MCPClientConfig{Url: url, Extensions: &Extensions{
+				CircuitBreaker: &CircuitBreakerExtensions{
+					FailureThreshold: 2,
+					OpenTimeout:      Duration(time.Hour),
+				},
+			}})
+			if err != nil {
+				t.Fatalf("NewMCPClient failed: %v", err)
+			}
+			defer c.Close()
+			if _, err := c.Initialize(context.Background()); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			for i := 0; i < 2; i++ {
+				if _, err := c.CallTool(context.Background(), tt.call, nil); err == nil {
+					t.Fatal("expected upstream failure")
+				}
+			}
+
+			_, err = c.CallTool(context.Background(), tt.call, nil)
+			var rpcErr *rpcError
+			if open := errors.As(err, &rpcErr) && rpcErr.code == errCodeUpstreamUnavailable; open != tt.expectOpen {
+				t.Fatalf("expected open circuit %v, got %v", tt.expectOpen, err)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.expectedCalls {
+				t.Errorf("expected %d upstream calls, got %d", tt.expectedCalls, got)
+			}
+		})
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	c := &MCPClient{config: &MCPClientConfig{}}
+	if got := c.requestTimeout(); got != defaultRequestTimeout {
+		t.Errorf("expected default timeout %v, got %v", defaultRequestTimeout, got)
+	}
+
+	c = &MCPClient{config: &MCPClientConfig{Extensions: &Extensions{Timeout: Duration(5 * time.Second)}}}
+	if got := c.requestTimeout(); got != 5*time.Second {
+		t.Errorf("expected timeout 5s, got %v", got)
+	}
+}
+
+// headerRecorder records the headers of the requests it receives
+type headerRecorder struct {
+	mu      sync.Mutex
+	headers []http.Header
+}
+
+func (h *headerRecorder) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		h.headers = append(h.headers, r.Header.Clone())
+		h.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *headerRecorder) all() []http.Header {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]http.Header(nil), h.headers...)
+}
+
+// streamableInitializeHandler is a minimal streamable HTTP MCP server that only answers initialize
+func streamableInitializeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["id"] == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req["id"],
+			"result": map[string]interface{}{
+				"protocolVersion": mcp.LATEST_PROTOCOL_VERSION,
+				"capabilities":    map[string]interface{}{},
+				"serverInfo":      map[string]interface{}{"name": "test", "version": "1.0.0"},
+			},
+		})
+	})
+}
+
+func TestNewMCPClientHeaders(t *testing.T) {
+	headers := map[string]string{
+		"Authorization": "Bearer test-token",
+		"X-Api-Key":     "test-key",
+	}
+
+	tests := []struct {
+		name    string
+		sse     bool
+		handler func() http.Handler
+	}{
+		{
+			name:    "Streamable HTTP",
+			handler: streamableInitializeHandler,
+		},
+		{
+			name: "SSE",
+			sse:  true,
+			handler: func() http.Handler {
+				srv := mcpserver.NewMCPServer("test-server", "1.0.0")
+				return mcpserver.NewSSEServer(srv, mcpserver.WithUseFullURLForMessageEndpoint(false))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &headerRecorder{}
+			ts := httptest.NewServer(recorder.wrap(tt.handler()))
+			defer ts.Close()
+
+			url := ts.URL
+			if tt.sse {
+				url += "/sse"
+			}
+			c, err := NewMCPClient(&MCPClientConfig{
+				Url:        url,
+				Headers:    headers,
+				Extensions: &Extensions{Sse: tt.sse},
+			})
+			if err != nil {
+				t.Fatalf("NewMCPClient failed: %v", err)
+			}
+			defer c.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := c.Initialize(ctx); err != nil {
+				t.Fatalf("Initialize failed: %v", err)
+			}
+
+			received := recorder.all()
+			if len(received) == 0 {
+				t.Fatal("no requests received")
+			}
+			for _, h := range received {
+				for key, value := range headers {
+					if got := h.Get(key); got != value {
+						t.Errorf("header %s = %q, want %q", key, got, value)
+					}
+				}
+			}
+		})
+	}
+}
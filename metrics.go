@@ -0,0 +1,197 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "mcp_proxy"
+
+	// Label of methods and tools the proxy does not know, so that clients
+	// cannot create arbitrary series
+	otherMethodLabel = "other"
+	unknownToolLabel = "unknown"
+)
+
+// Methods counted under their own name; others are counted as "other"
+var metricMethods = map[string]bool{
+	"initialize":                true,
+	"notifications/initialized": true,
+	"ping":                      true,
+	"tools/list":                true,
+	"tools/call":                true,
+	"logging/setLevel":          true,
+}
+
+// Metrics holds the Prometheus metrics of the proxy. Each Metrics has its own
+// registry, so that several servers can live in one process.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests             *prometheus.CounterVec
+	inFlightRequests     prometheus.Gauge
+	toolCalls            *prometheus.CounterVec
+	toolCallDuration     *prometheus.HistogramVec
+	toolsCacheLookups    *prometheus.CounterVec
+	upstreamInitDuration *prometheus.HistogramVec
+	upstreamRestarts     *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics and registers them with a new registry
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "JSON-RPC requests by method, server, tool and status.",
+		}, []string{"method", "server", "tool", "status"}),
+		inFlightRequests: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "in_flight_requests",
+			Help:      "Requests currently being served.",
+		}),
+		toolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tool_calls_total",
+			Help:      "Tool calls by server, tool and status.",
+		}, []string{"server", "tool", "status"}),
+		toolCallDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "tool_call_duration_seconds",
+			Help:      "Latency of tool calls, including approval and retries.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, []string{"server", "tool"}),
+		toolsCacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tools_cache_lookups_total",
+			Help:      "Lookups in the tools cache by server and result (hit or miss).",
+		}, []string{"server", "result"}),
+		upstreamInitDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_initialization_duration_seconds",
+			Help:      "Time to initialize upstream MCP servers by server and status.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"server", "status"}),
+		upstreamRestarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_restarts_total",
+			Help:      "Restarts of upstream MCP servers and their subprocesses.",
+		}, []string{"server"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.inFlightRequests,
+		m.toolCalls,
+		m.toolCallDuration,
+		m.toolsCacheLookups,
+		m.upstreamInitDuration,
+		m.upstreamRestarts,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// trackInFlight counts a request as in flight until the returned function is called
+func (m *Metrics) trackInFlight() func() {
+	if m == nil {
+		return func() {}
+	}
+	m.inFlightRequests.Inc()
+	return m.inFlightRequests.Dec
+}
+
+// observeRequest counts a JSON-RPC request
+func (m *Metrics) observeRequest(method, serverName, toolName, status string) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(method, serverName, toolName, status).Inc()
+}
+
+// methodLabel returns the method as a metric label
+func methodLabel(method string) string {
+	if method == "" || metricMethods[method] {
+		return method
+	}
+	return otherMethodLabel
+}
+
+// toolLabel returns the tool as a metric label. Tools are labeled by name if
+// they ran or one of the clients published them, and as "unknown" otherwise.
+func toolLabel(toolName string, ran bool, clients map[string]*MCPClient) string {
+	if ran {
+		return toolName
+	}
+	for _, client := range clients {
+		if client != nil && client.knowsTool(toolName) {
+			return toolName
+		}
+	}
+	return unknownToolLabel
+}
+
+// observeToolCall counts a tool call and records its latency
+func (m *Metrics) observeToolCall(serverName, toolName string, result *mcp.CallToolResult, err error, latency time.Duration) {
+	if m == nil {
+		return
+	}
+	status, _ := callStatus(result, err)
+	m.toolCalls.WithLabelValues(serverName, toolName, status).Inc()
+	m.toolCallDuration.WithLabelValues(serverName, toolName).Observe(latency.Seconds())
+}
+
+// observeToolsCache counts a lookup in the tools cache
+func (m *Metrics) observeToolsCache(serverName string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.toolsCacheLookups.WithLabelValues(serverName, result).Inc()
+}
+
+// observeUpstreamInit records how long initializing an upstream server took
+func (m *Metrics) observeUpstreamInit(serverName string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	m.upstreamInitDuration.WithLabelValues(serverName, status).Observe(duration.Seconds())
+}
+
+// observeUpstreamRestart counts a restart of an upstream server
+func (m *Metrics) observeUpstreamRestart(serverName string) {
+	if m == nil {
+		return
+	}
+	m.upstreamRestarts.WithLabelValues(serverName).Inc()
+}
+
+// httpStatusLabel returns the status label of a request that failed with an HTTP error
+func httpStatusLabel(status int) string {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return auditStatusRejected
+	default:
+		return auditStatusError
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapeMetrics returns the metrics served by the handler in the text format
+func scrapeMetrics(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 from /metrics, got %d", w.Code)
+	}
+	body, _ := io.ReadAll(w.Body)
+	return string(body)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	server := newScopedTestServer(t, false)
+	handler := server.routes()
+
+	doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/list","id":1}`)
+	doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/list","id":2}`)
+	doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"search_issues"},"id":3}`)
+	doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"delete_issue"},"id":4}`)
+	doJSONRPC(t, server, "/", "wrong-key", `{"jsonrpc":"2.0","method":"tools/list","id":5}`)
+	doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"made_up_1"},"id":6}`)
+	doJSONRPC(t, server, "/", "limited-key", `{"jsonrpc":"2.0","method":"made/up","id":7}`)
+
+	metrics := scrapeMetrics(t, handler)
+	expected := []string{
+		`mcp_proxy_requests_total{method="tools/list",server="",status="ok",tool=""} 2`,
+		`mcp_proxy_requests_total{method="tools/call",server="",status="ok",tool="search_issues"} 1`,
+		`mcp_proxy_requests_total{method="tools/call",server="",status="rejected",tool="delete_issue"} 1`,
+		`mcp_proxy_requests_total{method="",server="",status="rejected",tool=""} 1`,
+		`mcp_proxy_requests_total{method="tools/call",server="",status="error",tool="unknown"} 1`,
+		`mcp_proxy_requests_total{method="other",server="",status="error",tool=""} 1`,
+		`mcp_proxy_tool_calls_total{server="a",status="ok",tool="search_issues"} 1`,
+		`mcp_proxy_tool_call_duration_seconds_count{server="a",tool="search_issues"} 1`,
+		`mcp_proxy_tools_cache_lookups_total{result="miss",server="a"}`,
+		`mcp_proxy_tools_cache_lookups_total{result="hit",server="a"}`,
+		`mcp_proxy_in_flight_requests 0`,
+		`go_goroutines`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("expected %s in metrics", want)
+		}
+	}
+	if strings.Contains(metrics, "made_up") || strings.Contains(metrics, "made/up") {
+		t.Error("expected client supplied names not to be used as labels")
+	}
+}
+
+func TestMetricsSplitModeUnknownTool(t *testing.T) {
+	server := newScopedTestServer(t, true)
+
+	doJSONRPC(t, server, "/a", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"search_made_up"},"id":1}`)
+	doJSONRPC(t, server, "/a", "limited-key", `{"jsonrpc":"2.0","method":"tools/list","id":2}`)
+	doJSONRPC(t, server, "/a", "limited-key", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"delete_issue"},"id":3}`)
+
+	metrics := scrapeMetrics(t, server.routes())
+	expected := []string{
+		`mcp_proxy_requests_total{method="tools/call",server="a",status="error",tool="unknown"} 1`,
+		`mcp_proxy_tool_calls_total{server="a",status="error",tool="unknown"} 1`,
+		`mcp_proxy_requests_total{method="tools/call",server="a",status="rejected",tool="delete_issue"} 1`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("expected %s in metrics:\n%s", want, metrics)
+		}
+	}
+	if strings.Contains(metrics, "search_made_up") {
+		t.Error("expected the unknown tool not to be used as a label")
+	}
+}
+
+func TestMetricsSplitModeServerLabel(t *testing.T) {
+	server := newScopedTestServer(t, true)
+
+	doJSONRPC(t, server, "/a", "limited-key", `{"jsonrpc":"2.0","method":"tools/list","id":1}`)
+
+	metrics := scrapeMetrics(t, server.routes())
+	want := `mcp_proxy_requests_total{method="tools/list",server="a",status="ok",tool=""} 1`
+	if !strings.Contains(metrics, want) {
+		t.Errorf("expected %s in metrics", want)
+	}
+}
+
+func TestMetricsUpstream(t *testing.T) {
+	m := NewMetrics()
+	m.observeUpstreamInit("a", 300*time.Millisecond, nil)
+	m.observeUpstreamInit("b", time.Second, errors.New("timeout"))
+	m.observeUpstreamRestart("a")
+
+	done := m.trackInFlight()
+	metrics := scrapeMetrics(t, m.Handler())
+	done()
+
+	expected := []string{
+		`mcp_proxy_upstream_initialization_duration_seconds_count{server="a",status="ok"} 1`,
+		`mcp_proxy_upstream_initialization_duration_seconds_count{server="b",status="error"} 1`,
+		`mcp_proxy_upstream_restarts_total{server="a"} 1`,
+		`mcp_proxy_in_flight_requests 1`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("expected %s in metrics", want)
+		}
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.observeRequest("tools/list", "", "", "ok")
+	m.observeToolsCache("a", true)
+	m.observeUpstreamInit("a", time.Second, nil)
+	m.observeUpstreamRestart("a")
+	m.trackInFlight()()
+}
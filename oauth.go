@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tokens are refreshed this long before they expire
+const oauthExpiryDelta = 30 * time.Second
+
+// oauthTokenSource fetches access tokens with the OAuth 2.0 client credentials grant
+// and caches them until shortly before they expire
+type oauthTokenSource struct {
+	config     *OAuthConfig
+	httpClient *http.Client
+	logger     *slog.Logger
+	now        func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newOAuthTokenSource(config *OAuthConfig, logger *slog.Logger) *oauthTokenSource {
+	return &oauthTokenSource{
+		config:     config,
+		httpClient: &http.Client{Timeout: defaultRequestTimeout},
+		logger:     logger,
+		now:        time.Now,
+	}
+}
+
+// Token returns a valid access token, fetching a new one if the cached token
+// is missing or about to expire. If stale is set, a cached token equal to it is
+// treated as invalid; this is used after the upstream rejected it.
+func (s *oauthTokenSource) Token(ctx context.Context, stale string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && s.token != stale && (s.expiry.IsZero() || s.now().Add(oauthExpiryDelta).Before(s.expiry)) {
+		return s.token, nil
+	}
+
+	token, expiresIn, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	s.token = token
+	s.expiry = time.Time{}
+	if expiresIn > 0 {
+		s.expiry = s.now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	s.logger.DebugContext(ctx, "OAuth access token refreshed", "expires_in", expiresIn)
+	return s.token, nil
+}
+
+// fetch requests a new access token from the token endpoint
+func (s *oauthTokenSource) fetch(ctx context.Context) (string, int64, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", 0, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", 0, fmt.Errorf("token response has no access_token")
+	}
+	if tokenResp.TokenType != "" && !strings.EqualFold(tokenResp.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("unsupported token type: %s", tokenResp.TokenType)
+	}
+
+	return tokenResp.AccessToken, tokenResp.ExpiresIn, nil
+}
+
+// oauthTransport adds a bearer token to every upstream request. When the
+// upstream answers 401, the token is refreshed once and the request retried.
+type oauthTransport struct {
+	base   http.RoundTripper
+	tokens *oauthTokenSource
+}
+
+func (t *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.tokens.Token(req.Context(), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OAuth token: %w", err)
+	}
+
+	resp, err := t.base.RoundTrip(withBearerToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The request body has been consumed; it can only be retried if it can be recreated
+	retryReq := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retryReq.Body = body
+	}
+
+	newToken, err := t.tokens.Token(req.Context(), token)
+	if err != nil {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	t.tokens.logger.InfoContext(req.Context(), "Upstream rejected OAuth token, retrying with a refreshed token")
+	return t.base.RoundTrip(withBearerToken(retryReq, newToken))
+}
+
+// withBearerToken returns a copy of the request with the Authorization header set
+func withBearerToken(req *http.Request, token string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// newUpstreamHTTPClient creates the HTTP client used for SSE and Streamable HTTP servers
+func newUpstreamHTTPClient(config *MCPClientConfig, logger *slog.Logger) *http.Client {
+	var rt http.RoundTripper = http.DefaultTransport
+	if config.OAuth != nil {
+		rt = &oauthTransport{
+			base:   rt,
+			tokens: newOAuthTokenSource(config.OAuth, logger),
+		}
+	}
+	return &http.Client{Transport: rt}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestTokenServer returns a token endpoint that issues token-1, token-2, ... on each request
+func newTestTokenServer(t *testing.T, expiresIn int, requests *int32) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "test-client" || clientSecret != "test-secret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.PostForm.Get("grant_type") != "client_credentials" {
+			http.Error(w, `{"error":"unsupported_grant_type"}`, http.StatusBadRequest)
+			return
+		}
+		if got := r.PostForm.Get("scope"); got != "read write" {
+			http.Error(w, `{"error":"invalid_scope"}`, http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func testOAuthConfig(tokenURL string) *OAuthConfig {
+	return &OAuthConfig{
+		TokenURL:     tokenURL,
+		ClientID:     "test-client",
+		ClientSecret: "test-secret",
+		Scopes:       []string{"read", "write"},
+	}
+}
+
+func TestOAuthTokenSourceCaching(t *testing.T) {
+	var requests int32
+	ts := newTestTokenServer(t, 3600, &requests)
+
+	source := newOAuthTokenSource(testOAuthConfig(ts.URL), WithComponent("test"))
+	now := time.Now()
+	source.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		token, err := source.Token(ctx, "")
+		if err != nil {
+			t.Fatalf("Token failed: %v", err)
+		}
+		if token != "token-1" {
+			t.Errorf("expected cached token-1, got %s", token)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected 1 token request, got %d", got)
+	}
+
+	// Tokens are refreshed shortly before they expire
+	now = now.Add(3600*time.Second - oauthExpiryDelta/2)
+	token, err := source.Token(ctx, "")
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if token != "token-2" {
+		t.Errorf("expected refreshed token-2, got %s", token)
+	}
+
+	// A token rejected by the upstream is replaced even if it has not expired
+	token, err = source.Token(ctx, "token-2")
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if token != "token-3" {
+		t.Errorf("expected token-3 after rejection, got %s", token)
+	}
+}
+
+func TestOAuthTokenSourceError(t *testing.T) {
+	var requests int32
+	ts := newTestTokenServer(t, 3600, &requests)
+
+	config := testOAuthConfig(ts.URL)
+	config.ClientSecret = "wrong"
+	source := newOAuthTokenSource(config, WithComponent("test"))
+
+	if _, err := source.Token(context.Background(), ""); err == nil {
+		t.Error("expected error for invalid client credentials")
+	}
+}
+
+func TestOAuthTransportRetriesOnUnauthorized(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := newTestTokenServer(t, 3600, &tokenRequests)
+
+	// The upstream only accepts the second token, as if the first one had been revoked
+	var upstreamRequests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamRequests, 1)
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	httpClient := newUpstreamHTTPClient(&MCPClientConfig{OAuth: testOAuthConfig(tokenServer.URL)}, WithComponent("test"))
+
+	resp, err := httpClient.Post(upstream.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0"}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 after token refresh, got %d", resp.StatusCode)
+	}
+	if got := atomic.LoadInt32(&tokenRequests); got != 2 {
+		t.Errorf("expected 2 token requests, got %d", got)
+	}
+	if got := atomic.LoadInt32(&upstreamRequests); got != 2 {
+		t.Errorf("expected the request to be retried once, got %d upstream requests", got)
+	}
+}
+
+func TestOAuthTransportRetriesOnlyOnce(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := newTestTokenServer(t, 3600, &tokenRequests)
+
+	var upstreamRequests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamRequests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer upstream.Close()
+
+	httpClient := newUpstreamHTTPClient(&MCPClientConfig{OAuth: testOAuthConfig(tokenServer.URL)}, WithComponent("test"))
+
+	resp, err := httpClient.Post(upstream.URL, "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 to be passed through, got %d", resp.StatusCode)
+	}
+	if got := atomic.LoadInt32(&upstreamRequests); got != 2 {
+		t.Errorf("expected exactly 2 upstream requests, got %d", got)
+	}
+}
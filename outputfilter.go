@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const defaultOutputFilterMask = "[FILTERED]"
+
+// outputDetector finds one kind of sensitive data in text. If valid is set,
+// matches it rejects are left as they are.
+type outputDetector struct {
+	re    *regexp.Regexp
+	valid func(match string) bool
+}
+
+// Built-in detectors of personal data, by the name used in the config
+var outputDetectors = map[string]outputDetector{
+	"email": {re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	"phone": {re: regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)\s?|\d{2,4}[\s.-])\d{3,4}[\s.-]\d{3,4}\b`)},
+	"creditCard": {
+		re:    regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid: luhnValid,
+	},
+}
+
+// outputFilter is a compiled OutputFilter
+type outputFilter struct {
+	detectors []outputDetector
+	drop      []string
+	mask      string
+}
+
+// serverOutputFilters holds the output filters of one server
+type serverOutputFilters struct {
+	server *outputFilter
+	tools  map[string]*outputFilter
+}
+
+// newServerOutputFilters compiles the output filters of the server. It
+// returns nil if the server has none.
+func newServerOutputFilters(ext *Extensions) (*serverOutputFilters, error) {
+	if ext == nil || ext.OutputFilter == nil {
+		return nil, nil
+	}
+
+	f := &serverOutputFilters{tools: make(map[string]*outputFilter)}
+	if ext.OutputFilter.Server != nil {
+		filter, err := newOutputFilter(ext.OutputFilter.Server)
+		if err != nil {
+			return nil, err
+		}
+		f.server = filter
+	}
+	for name, cfg := range ext.OutputFilter.Tools {
+		filter, err := newOutputFilter(&cfg)
+		if err != nil {
+			return nil, fmt.Errorf("tool %s: %w", name, err)
+		}
+		f.tools[name] = filter
+	}
+	return f, nil
+}
+
+func newOutputFilter(cfg *OutputFilter) (*outputFilter, error) {
+	f := &outputFilter{mask: cfg.Mask}
+	if f.mask == "" {
+		f.mask = defaultOutputFilterMask
+	}
+
+	for _, name := range cfg.Detectors {
+		detector, ok := outputDetectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q", name)
+		}
+		f.detectors = append(f.detectors, detector)
+	}
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		f.detectors = append(f.detectors, outputDetector{re: re})
+	}
+	for _, drop := range cfg.DropContent {
+		if _, err := path.Match(drop, ""); err != nil {
+			return nil, fmt.Errorf("invalid content pattern %q: %w", drop, err)
+		}
+		f.drop = append(f.drop, strings.ToLower(drop))
+	}
+
+	return f, nil
+}
+
+// apply runs the server filter and then the tool filter on the result
+func (f *serverOutputFilters) apply(toolName string, result *mcp.CallToolResult) *mcp.CallToolResult {
+	if f == nil || result == nil {
+		return result
+	}
+	result = f.server.apply(result)
+	return f.tools[toolName].apply(result)
+}
+
+// apply returns a copy of the result with dropped content removed and
+// sensitive text masked
+func (f *outputFilter) apply(result *mcp.CallToolResult) *mcp.CallToolResult {
+	if f == nil {
+		return result
+	}
+
+	filtered := *result
+	filtered.Content = make([]mcp.Content, 0, len(result.Content))
+	for _, content := range result.Content {
+		if f.drops(content) {
+			continue
+		}
+		filtered.Content = append(filtered.Content, f.maskContent(content))
+	}
+	return &filtered
+}
+
+// drops checks if the content matches a content type or MIME type to drop
+func (f *outputFilter) drops(content mcp.Content) bool {
+	contentType, mimeType := describeContent(content)
+	for _, pattern := range f.drop {
+		if pattern == contentType {
+			return true
+		}
+		if mimeType != "" {
+			if matched, _ := path.Match(pattern, mimeType); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maskContent masks the text of text content and embedded text resources
+func (f *outputFilter) maskContent(content mcp.Content) mcp.Content {
+	switch c := content.(type) {
+	case mcp.TextContent:
+		c.Text = f.maskText(c.Text)
+		return c
+	case *mcp.TextContent:
+		masked := *c
+		masked.Text = f.maskText(c.Text)
+		return masked
+	case mcp.EmbeddedResource:
+		return f.maskResource(c)
+	case *mcp.EmbeddedResource:
+		return f.maskResource(*c)
+	default:
+		return content
+	}
+}
+
+func (f *outputFilter) maskResource(r mcp.EmbeddedResource) mcp.Content {
+	switch res := r.Resource.(type) {
+	case mcp.TextResourceContents:
+		res.Text = f.maskText(res.Text)
+		r.Resource = res
+	case *mcp.TextResourceContents:
+		masked := *res
+		masked.Text = f.maskText(res.Text)
+		r.Resource = masked
+	}
+	return r
+}
+
+// maskText replaces the matches of the detectors and patterns with the mask
+func (f *outputFilter) maskText(text string) string {
+	for _, d := range f.detectors {
+		text = d.re.ReplaceAllStringFunc(text, func(match string) string {
+			if d.valid != nil && !d.valid(match) {
+				return match
+			}
+			return f.mask
+		})
+	}
+	return text
+}
+
+// describeContent returns the content type and, if known, the MIME type of the content
+func describeContent(content mcp.Content) (string, string) {
+	switch c := content.(type) {
+	case mcp.TextContent, *mcp.TextContent:
+		return "text", "text/plain"
+	case mcp.ImageContent:
+		return "image", strings.ToLower(c.MIMEType)
+	case *mcp.ImageContent:
+		return "image", strings.ToLower(c.MIMEType)
+	case mcp.AudioContent:
+		return "audio", strings.ToLower(c.MIMEType)
+	case *mcp.AudioContent:
+		return "audio", strings.ToLower(c.MIMEType)
+	case mcp.EmbeddedResource:
+		return "resource", resourceMIMEType(c.Resource)
+	case *mcp.EmbeddedResource:
+		return "resource", resourceMIMEType(c.Resource)
+	default:
+		return "", ""
+	}
+}
+
+func resourceMIMEType(resource mcp.ResourceContents) string {
+	switch r := resource.(type) {
+	case mcp.TextResourceContents:
+		return strings.ToLower(r.MIMEType)
+	case *mcp.TextResourceContents:
+		return strings.ToLower(r.MIMEType)
+	case mcp.BlobResourceContents:
+		return strings.ToLower(r.MIMEType)
+	case *mcp.BlobResourceContents:
+		return strings.ToLower(r.MIMEType)
+	default:
+		return ""
+	}
+}
+
+// luhnValid checks the Luhn checksum of the digits in s, so that only
+// numbers that can be credit card numbers are masked
+func luhnValid(s string) bool {
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		digit := int(s[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+func TestNewServerOutputFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		ext     *Extensions
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "No extensions", ext: nil, wantNil: true},
+		{name: "No output filter", ext: &Extensions{}, wantNil: true},
+		{name: "Valid filters", ext: &Extensions{OutputFilter: &OutputFilterExtensions{
+			Server: &OutputFilter{Detectors: []string{"email", "phone", "creditCard"}, DropContent: []string{"image/*"}},
+			Tools:  map[string]OutputFilter{"lookup": {Patterns: []string{`CUST-\d+`}}},
+		}}},
+		{name: "Unknown detector", ext: &Extensions{OutputFilter: &OutputFilterExtensions{
+			Server: &OutputFilter{Detectors: []string{"ssn"}},
+		}}, wantErr: true},
+		{name: "Invalid tool pattern", ext: &Extensions{OutputFilter: &OutputFilterExtensions{
+			Tools: map[string]OutputFilter{"lookup": {Patterns: []string{"("}}},
+		}}, wantErr: true},
+		{name: "Invalid content pattern", ext: &Extensions{OutputFilter: &OutputFilterExtensions{
+			Server: &OutputFilter{DropContent: []string{"image/["}},
+		}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newServerOutputFilters(tt.ext)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newServerOutputFilters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (f == nil) != tt.wantNil {
+				t.Errorf("newServerOutputFilters() = %v, wantNil %v", f, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestOutputFilterMasking(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter OutputFilter
+		text   string
+		want   string
+	}{
+		{
+			name:   "Email",
+			filter: OutputFilter{Detectors: []string{"email"}},
+			text:   "Contact jane.doe+crm@example.co.jp today",
+			want:   "Contact [FILTERED] today",
+		},
+		{
+			name:   "Phone",
+			filter: OutputFilter{Detectors: []string{"phone"}},
+			text:   "Call +81 90-1234-5678 or (415) 555-0132, order 20240115",
+			want:   "Call [FILTERED] or [FILTERED], order 20240115",
+		},
+		{
+			name:   "Credit card with valid checksum",
+			filter: OutputFilter{Detectors: []string{"creditCard"}},
+			text:   "card 4111 1111 1111 1111, id 4111111111111112",
+			want:   "card [FILTERED], id 4111111111111112",
+		},
+		{
+			name:   "Pattern with custom mask",
+			filter: OutputFilter{Patterns: []string{`CUST-\d+`}, Mask: "***"},
+			text:   "customer CUST-0042 found",
+			want:   "customer *** found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newOutputFilter(&tt.filter)
+			if err != nil {
+				t.Fatalf("newOutputFilter failed: %v", err)
+			}
+			result := f.apply(mcp.NewToolResultText(tt.text))
+			if got := result.Content[0].(mcp.TextContent).Text; got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFilterDropContent(t *testing.T) {
+	result := &mcp.CallToolResult{Content: []mcp.Content{
+		mcp.NewTextContent("report"),
+		mcp.NewImageContent("aW1n", "image/png"),
+		mcp.NewAudioContent("YXVk", "audio/wav"),
+		mcp.NewEmbeddedResource(mcp.BlobResourceContents{URI: "file:///a.pdf", MIMEType: "application/pdf", Blob: "cGRm"}),
+		mcp.NewEmbeddedResource(mcp.TextResourceContents{URI: "file:///a.txt", MIMEType: "text/plain", Text: "mail a@b.io"}),
+	}}
+
+	f, err := newOutputFilter(&OutputFilter{Detectors: []string{"email"}, DropContent: []string{"image/*", "audio", "application/pdf"}})
+	if err != nil {
+		t.Fatalf("newOutputFilter failed: %v", err)
+	}
+	filtered := f.apply(result)
+
+	var types []string
+	for _, content := range filtered.Content {
+		contentType, _ := describeContent(content)
+		types = append(types, contentType)
+	}
+	if !reflect.DeepEqual(types, []string{"text", "resource"}) {
+		t.Fatalf("unexpected content after filtering: %v", types)
+	}
+	resource := filtered.Content[1].(mcp.EmbeddedResource).Resource.(mcp.TextResourceContents)
+	if resource.Text != "mail [FILTERED]" {
+		t.Errorf("expected the embedded text to be masked, got %q", resource.Text)
+	}
+	if len(result.Content) != 5 {
+		t.Error("expected the upstream result to stay unchanged")
+	}
+}
+
+func TestOutputFiltersOnToolCall(t *testing.T) {
+	lookup := mcpserver.ServerTool{
+		Tool: mcp.NewTool("lookup"),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return &mcp.CallToolResult{Content: []mcp.Content{
+				mcp.NewTextContent("CUST-7 jane@example.com"),
+				mcp.NewImageContent("aW1n", "image/png"),
+			}}, nil
+		},
+	}
+	client := newInProcessMCPClient(t, &MCPClientConfig{
+		Extensions: &Extensions{OutputFilter: &OutputFilterExtensions{
+			Server: &OutputFilter{Detectors: []string{"email"}, DropContent: []string{"image"}},
+			Tools:  map[string]OutputFilter{"lookup": {Patterns: []string{`CUST-\d+`}, Mask: "<id>"}},
+		}},
+	}, lookup)
+	server := NewServer(map[string]*MCPClient{"crm": client}, false)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"tools/call","params":{"name":"lookup"},"id":1}`))
+	w := httptest.NewRecorder()
+	server.handleJSONRPC(w, req)
+
+	var resp struct {
+		Result struct {
+			Content []map[string]interface{} `json:"content"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(resp.Result.Content) != 1 || resp.Result.Content[0]["text"] != "<id> [FILTERED]" {
+		t.Errorf("expected filtered content, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/operators"
+	"github.com/google/cel-go/common/types"
+)
+
+const (
+	policyEffectAllow = "allow"
+	policyEffectDeny  = "deny"
+)
+
+// PolicyEngine authorizes tool calls with CEL rules
+type PolicyEngine struct {
+	rules        []policyRule
+	defaultAllow bool
+	logger       *slog.Logger
+}
+
+type policyRule struct {
+	PolicyRule
+	allow   bool
+	program cel.Program
+	// Arguments the expression reads, as args.name or args["name"]
+	argKeys []string
+}
+
+// policyDecision is the outcome of evaluating the policy for a tool call
+type policyDecision struct {
+	allowed bool
+	// Name of the rule that decided, empty if no rule matched
+	rule   string
+	reason string
+}
+
+// NewPolicyEngine compiles the rules of the policy config
+func NewPolicyEngine(cfg *PolicyConfig) (*PolicyEngine, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("caller", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("server", cel.StringType),
+		cel.Variable("tool", cel.StringType),
+		cel.Variable("args", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PolicyEngine{logger: WithComponent("policy")}
+	switch cfg.Default {
+	case "", policyEffectAllow:
+		p.defaultAllow = true
+	case policyEffectDeny:
+	default:
+		return nil, fmt.Errorf("invalid default effect %q", cfg.Default)
+	}
+
+	for i, rule := range cfg.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.Effect != policyEffectAllow && rule.Effect != policyEffectDeny {
+			return nil, fmt.Errorf("policy %s has invalid effect %q", rule.Name, rule.Effect)
+		}
+
+		ast, issues := env.Compile(rule.Match)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("policy %s has invalid expression: %w", rule.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType {
+			return nil, fmt.Errorf("policy %s expression must return a bool, got %s", rule.Name, ast.OutputType())
+		}
+		program, err := env.Program(ast, cel.EvalOptions(cel.OptPartialEval))
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", rule.Name, err)
+		}
+
+		p.rules = append(p.rules, policyRule{
+			PolicyRule: rule,
+			allow:      rule.Effect == policyEffectAllow,
+			program:    program,
+			argKeys:    argumentKeys(ast.NativeRep().Expr()),
+		})
+	}
+
+	return p, nil
+}
+
+// argumentKeys returns the keys of args that the expression reads
+func argumentKeys(expr celast.Expr) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	isArgs := func(e celast.Expr) bool {
+		return e.Kind() == celast.IdentKind && e.AsIdent() == "args"
+	}
+	celast.PostOrderVisit(expr, celast.NewExprVisitor(func(e celast.Expr) {
+		switch e.Kind() {
+		case celast.SelectKind:
+			if sel := e.AsSelect(); isArgs(sel.Operand()) {
+				add(sel.FieldName())
+			}
+		case celast.CallKind:
+			call := e.AsCall()
+			if call.FunctionName() != operators.Index || len(call.Args()) != 2 || !isArgs(call.Args()[0]) {
+				return
+			}
+			if index := call.Args()[1]; index.Kind() == celast.LiteralKind {
+				if key, ok := index.AsLiteral().Value().(string); ok {
+					add(key)
+				}
+			}
+		}
+	}))
+	return keys
+}
+
+// policyVars returns the variables the rule expressions are evaluated with
+func policyVars(caller *Caller, serverName, toolName string, args map[string]interface{}) map[string]interface{} {
+	callerVar := map[string]interface{}{"id": "", "groups": []string{}}
+	if caller != nil {
+		callerVar["id"] = caller.ID
+		if caller.Groups != nil {
+			callerVar["groups"] = caller.Groups
+		}
+	}
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"caller": callerVar,
+		"server": serverName,
+		"tool":   toolName,
+		"args":   args,
+	}
+}
+
+// evaluate decides if the caller may call the tool with the given arguments.
+// An allow rule that reads a missing argument does not match, while a deny
+// rule that does denies the call, so that leaving out an argument does not
+// get around it. A rule that fails to evaluate for any other reason denies
+// the call too.
+func (p *PolicyEngine) evaluate(ctx context.Context, caller *Caller, serverName, toolName string, args map[string]interface{}) policyDecision {
+	if p == nil {
+		return policyDecision{allowed: true}
+	}
+
+	vars := policyVars(caller, serverName, toolName, args)
+	for _, rule := range p.rules {
+		out, _, err := rule.program.Eval(vars)
+		switch {
+		case err != nil && rule.readsMissingArgument(vars, args):
+			if rule.allow {
+				continue
+			}
+			return policyDecision{rule: rule.Name, reason: rule.denyReason()}
+		case err != nil:
+			p.logger.ErrorContext(ctx, "Failed to evaluate policy",
+				"policy", rule.Name,
+				"server", serverName,
+				"tool", toolName,
+				"error", err)
+			return policyDecision{rule: rule.Name, reason: fmt.Sprintf("policy %s could not be evaluated", rule.Name)}
+		case out != types.True:
+			continue
+		}
+
+		decision := policyDecision{allowed: rule.allow, rule: rule.Name}
+		if !rule.allow {
+			decision.reason = rule.denyReason()
+		}
+		return decision
+	}
+
+	if p.defaultAllow {
+		return policyDecision{allowed: true}
+	}
+	return policyDecision{reason: "no policy allows the call"}
+}
+
+// readsMissingArgument checks if the rule failed to evaluate because it reads
+// arguments the call does not have. The rule is evaluated again with those
+// arguments unknown, which gives an unknown result instead of the error.
+func (r *policyRule) readsMissingArgument(vars, args map[string]interface{}) bool {
+	var missing []*cel.AttributePatternType
+	for _, key := range r.argKeys {
+		if _, ok := args[key]; !ok {
+			missing = append(missing, cel.AttributePattern("args").QualString(key))
+		}
+	}
+	if len(missing) == 0 {
+		return false
+	}
+	partial, err := cel.PartialVars(vars, missing...)
+	if err != nil {
+		return false
+	}
+	out, _, _ := r.program.Eval(partial)
+	return types.IsUnknown(out)
+}
+
+// denyReason returns the reason given for calls the rule denies
+func (r *policyRule) denyReason() string {
+	if r.Message != "" {
+		return r.Message
+	}
+	return fmt.Sprintf("denied by policy %s", r.Name)
+}
+
+// mayAllow checks if the policy allows calling the tool with at least some
+// arguments. It is used to filter tools/list, where the arguments are unknown.
+func (p *PolicyEngine) mayAllow(caller *Caller, serverName, toolName string) bool {
+	if p == nil {
+		return true
+	}
+
+	vars, err := cel.PartialVars(policyVars(caller, serverName, toolName, nil), cel.AttributePattern("args"))
+	if err != nil {
+		return true
+	}
+	for _, rule := range p.rules {
+		out, _, err := rule.program.Eval(vars)
+		switch {
+		case err == nil && out == types.True:
+			return rule.allow
+		case err == nil && out == types.False:
+			continue
+		case rule.allow:
+			// Depends on the arguments, so some calls may be allowed
+			return true
+		}
+		// A deny rule that depends on the arguments lets some calls through
+		// to the rules after it
+	}
+	return p.defaultAllow
+}
+
+// newPolicyDeniedError creates the JSON-RPC error returned when the policy denies a tool call
+func newPolicyDeniedError(decision policyDecision) *rpcError {
+	data := map[string]interface{}{"reason": decision.reason}
+	if decision.rule != "" {
+		data["policy"] = decision.rule
+	}
+	return &rpcError{
+		code:    errCodeForbidden,
+		message: "Forbidden",
+		data:    data,
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/cel-go/cel"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func testPolicyConfig() *PolicyConfig {
+	return &PolicyConfig{
+		Rules: []PolicyRule{
+			{
+				Name:    "oncall-restarts",
+				Match:   `tool.startsWith("restart_") && !("oncall" in caller.groups)`,
+				Effect:  "deny",
+				Message: "only oncall may restart services",
+			},
+			{
+				Name:   "no-prod-queries",
+				Match:  `tool == "query_db" && has(args.database) && args.database == "prod"`,
+				Effect: "deny",
+			},
+			{
+				Name:   "no-deletes-on-b",
+				Match:  `server == "b" && tool.startsWith("delete_")`,
+				Effect: "deny",
+			},
+		},
+	}
+}
+
+func TestNewPolicyEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PolicyConfig
+		wantErr bool
+	}{
+		{name: "Valid rules", config: *testPolicyConfig()},
+		{name: "Default deny", config: PolicyConfig{Default: "deny"}},
+		{name: "Invalid default", config: PolicyConfig{Default: "maybe"}, wantErr: true},
+		{name: "Invalid effect", config: PolicyConfig{Rules: []PolicyRule{{Match: "true", Effect: "block"}}}, wantErr: true},
+		{name: "Syntax error", config: PolicyConfig{Rules: []PolicyRule{{Match: "tool ==", Effect: "deny"}}}, wantErr: true},
+		{name: "Unknown variable", config: PolicyConfig{Rules: []PolicyRule{{Match: `user == "alice"`, Effect: "deny"}}}, wantErr: true},
+		{name: "Not a bool", config: PolicyConfig{Rules: []PolicyRule{{Match: "tool", Effect: "deny"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPolicyEngine(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPolicyEngine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy, err := NewPolicyEngine(testPolicyConfig())
+	if err != nil {
+		t.Fatalf("NewPolicyEngine failed: %v", err)
+	}
+	oncall := &Caller{ID: "alice", Groups: []string{"oncall"}}
+	dev := &Caller{ID: "bob", Groups: []string{"dev"}}
+
+	tests := []struct {
+		name       string
+		caller     *Caller
+		server     string
+		tool       string
+		args       map[string]interface{}
+		allowed    bool
+		rule       string
+		reasonPart string
+	}{
+		{name: "Oncall may restart", caller: oncall, server: "a", tool: "restart_api", allowed: true},
+		{name: "Others may not restart", caller: dev, server: "a", tool: "restart_api", rule: "oncall-restarts", reasonPart: "only oncall"},
+		{name: "Unknown caller may not restart", server: "a", tool: "restart_api", rule: "oncall-restarts"},
+		{name: "Query on staging", caller: dev, server: "a", tool: "query_db", args: map[string]interface{}{"database": "staging"}, allowed: true},
+		{name: "Query on prod", caller: dev, server: "a", tool: "query_db", args: map[string]interface{}{"database": "prod"}, rule: "no-prod-queries", reasonPart: "no-prod-queries"},
+		{name: "Query without database", caller: dev, server: "a", tool: "query_db", allowed: true},
+		{name: "Delete on a", caller: dev, server: "a", tool: "delete_issue", allowed: true},
+		{name: "Delete on b", caller: dev, server: "b", tool: "delete_issue", rule: "no-deletes-on-b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := policy.evaluate(context.Background(), tt.caller, tt.server, tt.tool, tt.args)
+			if decision.allowed != tt.allowed {
+				t.Fatalf("expected allowed=%v, got %+v", tt.allowed, decision)
+			}
+			if decision.rule != tt.rule {
+				t.Errorf("expected rule %q, got %q", tt.rule, decision.rule)
+			}
+			if !strings.Contains(decision.reason, tt.reasonPart) {
+				t.Errorf("expected reason to contain %q, got %q", tt.reasonPart, decision.reason)
+			}
+		})
+	}
+}
+
+func TestPolicyDefaultDeny(t *testing.T) {
+	policy, err := NewPolicyEngine(&PolicyConfig{
+		Default: "deny",
+		Rules: []PolicyRule{
+			{Name: "readers", Match: `tool.startsWith("get_")`, Effect: "allow"},
+			{Name: "small-queries", Match: `tool == "query" && args.limit <= 100`, Effect: "allow"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicyEngine failed: %v", err)
+	}
+
+	if d := policy.evaluate(context.Background(), nil, "a", "get_issue", nil); !d.allowed {
+		t.Errorf("expected get_issue to be allowed, got %+v", d)
+	}
+	if d := policy.evaluate(context.Background(), nil, "a", "delete_issue", nil); d.allowed || d.rule != "" {
+		t.Errorf("expected delete_issue to be denied by default, got %+v", d)
+	}
+	if d := policy.evaluate(context.Background(), nil, "a", "query", map[string]interface{}{"limit": 10}); !d.allowed {
+		t.Errorf("expected small query to be allowed, got %+v", d)
+	}
+	// An allow rule that reads a missing argument does not match
+	if d := policy.evaluate(context.Background(), nil, "a", "query", nil); d.allowed || d.rule != "" {
+		t.Errorf("expected query without limit to be denied by default, got %+v", d)
+	}
+}
+
+func TestPolicyMissingArguments(t *testing.T) {
+	policy, err := NewPolicyEngine(&PolicyConfig{
+		Rules: []PolicyRule{
+			{Name: "staging-only", Match: `tool == "query_db" && args.database != "staging"`, Effect: "deny"},
+			{Name: "large-exports", Match: `tool == "export" && has(args.rows) && args.rows > 1000`, Effect: "deny"},
+			{Name: "readers", Match: `args["mode"] == "read"`, Effect: "allow"},
+			{Name: "broken", Match: `tool == "divide" && 1 / args.divisor == 1`, Effect: "deny"},
+			{Name: "no-writes", Match: `tool.startsWith("write_")`, Effect: "deny"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicyEngine failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		tool    string
+		args    map[string]interface{}
+		allowed bool
+		rule    string
+	}{
+		{name: "Deny rule without the argument", tool: "query_db", rule: "staging-only"},
+		{name: "Deny rule with other arguments", tool: "query_db", args: map[string]interface{}{"limit": 1}, rule: "staging-only"},
+		{name: "Deny rule not matching", tool: "query_db", args: map[string]interface{}{"database": "staging"}, allowed: true},
+		{name: "Deny rule matching", tool: "query_db", args: map[string]interface{}{"database": "prod"}, rule: "staging-only"},
+		{name: "Guarded deny rule without the argument", tool: "export", allowed: true},
+		{name: "Allow rule without the argument", tool: "write_file", rule: "no-writes"},
+		{name: "Allow rule matching", tool: "write_file", args: map[string]interface{}{"mode": "read"}, allowed: true, rule: "readers"},
+		{name: "Other evaluation errors deny", tool: "divide", args: map[string]interface{}{"divisor": 0}, rule: "broken"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := policy.evaluate(context.Background(), nil, "a", tt.tool, tt.args)
+			if d.allowed != tt.allowed || d.rule != tt.rule {
+				t.Errorf("evaluate() = %+v, want allowed %v by rule %q", d, tt.allowed, tt.rule)
+			}
+		})
+	}
+}
+
+func TestArgumentKeys(t *testing.T) {
+	env, err := cel.NewEnv(
+		cel.Variable("tool", cel.StringType),
+		cel.Variable("args", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		t.Fatalf("cel.NewEnv failed: %v", err)
+	}
+
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{expr: `tool == "a"`},
+		{expr: `args.database == "prod"`, expected: []string{"database"}},
+		{expr: `args["database"] == "prod" && args.limit > 10 && args.database != ""`, expected: []string{"database", "limit"}},
+		{expr: `has(args.rows) && args.rows > 1000`, expected: []string{"rows"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			ast, issues := env.Compile(tt.expr)
+			if issues != nil && issues.Err() != nil {
+				t.Fatalf("Compile failed: %v", issues.Err())
+			}
+			got := argumentKeys(ast.NativeRep().Expr())
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("argumentKeys() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPolicyMayAllow(t *testing.T) {
+	policy, err := NewPolicyEngine(&PolicyConfig{
+		Default: "deny",
+		Rules: []PolicyRule{
+			{Name: "no-prod", Match: `tool == "query_db" && args.database == "prod"`, Effect: "deny"},
+			{Name: "queries", Match: `tool == "query_db"`, Effect: "allow"},
+			{Name: "small-exports", Match: `tool == "export" && args.rows < 1000`, Effect: "allow"},
+			{Name: "oncall", Match: `"oncall" in caller.groups`, Effect: "allow"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicyEngine failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		caller   *Caller
+		tool     string
+		expected bool
+	}{
+		{name: "Deny rule that depends on args", tool: "query_db", expected: true},
+		{name: "Allow rule that depends on args", tool: "export", expected: true},
+		{name: "No rule allows", tool: "restart", expected: false},
+		{name: "Caller-based rule", caller: &Caller{ID: "alice", Groups: []string{"oncall"}}, tool: "restart", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.mayAllow(tt.caller, "a", tt.tool); got != tt.expected {
+				t.Errorf("mayAllow(%s) = %v, want %v", tt.tool, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPolicyEnforcedByServer(t *testing.T) {
+	server := newScopedTestServer(t, false)
+	server.authenticator = nil
+	policy, err := NewPolicyEngine(&PolicyConfig{Rules: []PolicyRule{
+		{Name: "no-deletes", Match: `tool.startsWith("delete_")`, Effect: "deny", Message: "deletes are disabled"},
+		{Name: "no-secret-search", Match: `tool == "search_docs" && args.query == "secret"`, Effect: "deny"},
+	}})
+	if err != nil {
+		t.Fatalf("NewPolicyEngine failed: %v", err)
+	}
+	server.policy = policy
+
+	// tools/list hides tools the policy always denies
+	_, resp := doJSONRPC(t, server, "/", "", `{"jsonrpc":"2.0","method":"tools/list","id":1}`)
+	result, _ := json.Marshal(resp.Result)
+	var list mcp.ListToolsResult
+	if err := json.Unmarshal(result, &list); err != nil {
+		t.Fatalf("Failed to parse tools/list result: %v", err)
+	}
+	var names []string
+	for _, tool := range list.Tools {
+		names = append(names, tool.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "search_docs,search_issues" {
+		t.Errorf("expected delete_issue to be hidden, got %v", names)
+	}
+
+	// Denied calls get a structured error
+	_, resp = doJSONRPC(t, server, "/", "", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"delete_issue"},"id":2}`)
+	if resp.Error == nil || resp.Error.Code != errCodeForbidden {
+		t.Fatalf("expected forbidden error, got %+v", resp)
+	}
+	data, _ := resp.Error.Data.(map[string]interface{})
+	if data["policy"] != "no-deletes" || data["reason"] != "deletes are disabled" {
+		t.Errorf("unexpected error data %v", resp.Error.Data)
+	}
+
+	_, resp = doJSONRPC(t, server, "/", "", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"search_docs","arguments":{"query":"secret"}},"id":3}`)
+	if resp.Error == nil || resp.Error.Code != errCodeForbidden {
+		t.Errorf("expected forbidden error, got %+v", resp)
+	}
+
+	_, resp = doJSONRPC(t, server, "/", "", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"search_docs","arguments":{"query":"public"}},"id":4}`)
+	if resp.Error != nil {
+		t.Errorf("expected allowed call to succeed, got %+v", resp.Error)
+	}
+}
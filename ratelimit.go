@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Idle per-caller buckets are dropped at most this often
+const rateLimitSweepInterval = time.Minute
+
+// tokenBucket is a token bucket rate limiter
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket for the limit, or returns nil if the limit allows everything
+func newTokenBucket(limit *RateLimit, now time.Time) *tokenBucket {
+	if limit == nil || limit.Requests <= 0 {
+		return nil
+	}
+	period := time.Duration(limit.Period)
+	if period <= 0 {
+		period = time.Second
+	}
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = limit.Requests
+	}
+	return &tokenBucket{
+		rate:   float64(limit.Requests) / period.Seconds(),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// take takes a token. If none is left, it returns how long until one is available.
+func (b *tokenBucket) take(now time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait := (1 - b.tokens) / b.rate
+	return time.Duration(wait * float64(time.Second)), false
+}
+
+// giveBack returns a token taken for a call that another limit rejected
+func (b *tokenBucket) giveBack() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// full checks if the bucket has refilled completely, i.e. it has been idle for a while
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// serverRateLimits enforces the rate limits of one server from its _extensions
+type serverRateLimits struct {
+	server *tokenBucket
+	tools  map[string]*tokenBucket
+}
+
+func newServerRateLimits(ext *Extensions) *serverRateLimits {
+	if ext == nil || ext.RateLimit == nil {
+		return nil
+	}
+	now := time.Now()
+	l := &serverRateLimits{
+		server: newTokenBucket(ext.RateLimit.Server, now),
+		tools:  make(map[string]*tokenBucket),
+	}
+	for name, limit := range ext.RateLimit.Tools {
+		if bucket := newTokenBucket(&limit, now); bucket != nil {
+			l.tools[name] = bucket
+		}
+	}
+	return l
+}
+
+// take takes a token for a call to the tool. A call rejected by the server
+// limit gives its tool token back, so rejected calls use up no limit.
+func (l *serverRateLimits) take(toolName string, now time.Time) error {
+	if l == nil {
+		return nil
+	}
+	tool := l.tools[toolName]
+	if tool != nil {
+		if retryAfter, ok := tool.take(now); !ok {
+			return newRateLimitedError("tool", retryAfter)
+		}
+	}
+	if l.server != nil {
+		if retryAfter, ok := l.server.take(now); !ok {
+			if tool != nil {
+				tool.giveBack()
+			}
+			return newRateLimitedError("server", retryAfter)
+		}
+	}
+	return nil
+}
+
+// giveBack returns the tokens taken for a call that a proxy-wide limit rejected
+func (l *serverRateLimits) giveBack(toolName string) {
+	if l == nil {
+		return
+	}
+	if tool := l.tools[toolName]; tool != nil {
+		tool.giveBack()
+	}
+	if l.server != nil {
+		l.server.giveBack()
+	}
+}
+
+// RateLimiter enforces the proxy-wide rate limits
+type RateLimiter struct {
+	global    *tokenBucket
+	perCaller *RateLimit
+
+	mu        sync.Mutex
+	callers   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter creates a rate limiter from the rate limit config
+func NewRateLimiter(cfg *RateLimitConfig) *RateLimiter {
+	now := time.Now()
+	return &RateLimiter{
+		global:    newTokenBucket(cfg.Global, now),
+		perCaller: cfg.PerCaller,
+		callers:   make(map[string]*tokenBucket),
+		lastSweep: now,
+	}
+}
+
+// take takes a token for a call by the caller in ctx. Callers are told apart
+// by their identity, or by their IP if they are not identified. A call
+// rejected by the global limit gives its caller token back.
+func (l *RateLimiter) take(ctx context.Context, now time.Time) error {
+	if l == nil {
+		return nil
+	}
+
+	caller := l.callerBucket(ctx, now)
+	if caller != nil {
+		if retryAfter, ok := caller.take(now); !ok {
+			return newRateLimitedError("caller", retryAfter)
+		}
+	}
+	if l.global != nil {
+		if retryAfter, ok := l.global.take(now); !ok {
+			if caller != nil {
+				caller.giveBack()
+			}
+			return newRateLimitedError("global", retryAfter)
+		}
+	}
+	return nil
+}
+
+func (l *RateLimiter) callerBucket(ctx context.Context, now time.Time) *tokenBucket {
+	if l.perCaller == nil || l.perCaller.Requests <= 0 {
+		return nil
+	}
+
+	key := "ip:" + clientIPFromContext(ctx)
+	if caller := callerFromContext(ctx); caller != nil {
+		key = "caller:" + caller.ID
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		for k, bucket := range l.callers {
+			if bucket.full(now) {
+				delete(l.callers, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucket, ok := l.callers[key]
+	if !ok {
+		bucket = newTokenBucket(l.perCaller, now)
+		l.callers[key] = bucket
+	}
+	return bucket
+}
+
+// newRateLimitedError creates the JSON-RPC error returned when a rate limit is
+// exceeded. It is sent with HTTP status 429.
+func newRateLimitedError(limit string, retryAfter time.Duration) *rpcError {
+	return &rpcError{
+		code:    errCodeRateLimited,
+		message: "Rate limit exceeded",
+		data: map[string]interface{}{
+			"limit":             limit,
+			"retryAfterSeconds": int(math.Ceil(retryAfter.Seconds())),
+		},
+		status:     http.StatusTooManyRequests,
+		retryAfter: retryAfter,
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name  string
+		limit *RateLimit
+		// Offsets from start at which calls are made, and whether each is allowed
+		calls   []time.Duration
+		allowed []bool
+	}{
+		{
+			name:    "Burst defaults to requests",
+			limit:   &RateLimit{Requests: 2, Period: Duration(time.Second)},
+			calls:   []time.Duration{0, 0, 0, 500 * time.Millisecond, 600 * time.Millisecond},
+			allowed: []bool{true, true, false, true, false},
+		},
+		{
+			name:    "Explicit burst",
+			limit:   &RateLimit{Requests: 2, Period: Duration(time.Minute), Burst: 1},
+			calls:   []time.Duration{0, 0, 20 * time.Second, 30 * time.Second},
+			allowed: []bool{true, false, false, true},
+		},
+		{
+			name:    "Tokens do not pile up beyond the burst",
+			limit:   &RateLimit{Requests: 1, Burst: 2},
+			calls:   []time.Duration{time.Hour, time.Hour, time.Hour},
+			allowed: []bool{true, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := newTokenBucket(tt.limit, start)
+			for i, offset := range tt.calls {
+				if _, ok := bucket.take(start.Add(offset)); ok != tt.allowed[i] {
+					t.Errorf("call %d at %v: allowed = %v, want %v", i, offset, ok, tt.allowed[i])
+				}
+			}
+		})
+	}
+
+	if newTokenBucket(nil, start) != nil || newTokenBucket(&RateLimit{}, start) != nil {
+		t.Error("expected no bucket for an unset limit")
+	}
+}
+
+func TestTokenBucketRetryAfter(t *testing.T) {
+	start := time.Now()
+	bucket := newTokenBucket(&RateLimit{Requests: 1, Period: Duration(10 * time.Second)}, start)
+	bucket.take(start)
+
+	retryAfter, ok := bucket.take(start.Add(4 * time.Second))
+	if ok {
+		t.Fatal("expected call to be rejected")
+	}
+	if retryAfter < 5900*time.Millisecond || retryAfter > 6100*time.Millisecond {
+		t.Errorf("expected retry after about 6s, got %v", retryAfter)
+	}
+}
+
+func TestServerRateLimits(t *testing.T) {
+	limits := newServerRateLimits(&Extensions{RateLimit: &RateLimitExtensions{
+		Server: &RateLimit{Requests: 3, Period: Duration(time.Minute)},
+		Tools: map[string]RateLimit{
+			"expensive": {Requests: 1, Period: Duration(time.Minute)},
+		},
+	}})
+	now := time.Now()
+
+	if err := limits.take("expensive", now); err != nil {
+		t.Fatalf("expected first call to be allowed, got %v", err)
+	}
+	err := limits.take("expensive", now)
+	if rpcErr, ok := err.(*rpcError); !ok || rpcErr.data.(map[string]interface{})["limit"] != "tool" {
+		t.Fatalf("expected tool limit error, got %v", err)
+	}
+
+	// The rejected call did not use up the server limit
+	for i := 0; i < 2; i++ {
+		if err := limits.take("cheap", now); err != nil {
+			t.Fatalf("expected call %d to be allowed, got %v", i, err)
+		}
+	}
+	err = limits.take("cheap", now)
+	if rpcErr, ok := err.(*rpcError); !ok || rpcErr.data.(map[string]interface{})["limit"] != "server" {
+		t.Errorf("expected server limit error, got %v", err)
+	}
+
+	if newServerRateLimits(&Extensions{}).take("any", now) != nil {
+		t.Error("expected no limit without config")
+	}
+}
+
+func TestRateLimiterPerCaller(t *testing.T) {
+	limiter := NewRateLimiter(&RateLimitConfig{
+		Global:    &RateLimit{Requests: 3, Period: Duration(time.Minute)},
+		PerCaller: &RateLimit{Requests: 1, Period: Duration(time.Minute)},
+	})
+	now := time.Now()
+
+	ipCtx := func(remoteAddr string) context.Context {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = remoteAddr
+		return withClientIP(context.Background(), r)
+	}
+	alice := withCaller(ipCtx("10.0.0.1:1234"), &Caller{ID: "alice"})
+	bob := withCaller(ipCtx("10.0.0.1:1234"), &Caller{ID: "bob"})
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		limit string
+	}{
+		{name: "Alice first call", ctx: alice},
+		{name: "Alice second call", ctx: alice, limit: "caller"},
+		{name: "Bob from the same IP", ctx: bob},
+		{name: "Anonymous client", ctx: ipCtx("10.0.0.2:1234")},
+		{name: "Same anonymous client, other port", ctx: ipCtx("10.0.0.2:5678"), limit: "caller"},
+		{name: "Global limit", ctx: ipCtx("10.0.0.3:1234"), limit: "global"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := limiter.take(tt.ctx, now)
+			if tt.limit == "" {
+				if err != nil {
+					t.Errorf("expected call to be allowed, got %v", err)
+				}
+				return
+			}
+			rpcErr, ok := err.(*rpcError)
+			if !ok || rpcErr.data.(map[string]interface{})["limit"] != tt.limit {
+				t.Errorf("expected %s limit error, got %v", tt.limit, err)
+			}
+		})
+	}
+
+	// Idle callers are forgotten
+	limiter.take(alice, now.Add(2*rateLimitSweepInterval))
+	if len(limiter.callers) != 1 {
+		t.Errorf("expected idle callers to be dropped, got %d", len(limiter.callers))
+	}
+}
+
+func TestRejectedCallsGiveTokensBack(t *testing.T) {
+	minute := Duration(time.Minute)
+	alice := withCaller(context.Background(), &Caller{ID: "alice"})
+	bob := withCaller(context.Background(), &Caller{ID: "bob"})
+
+	t.Run("Server limit", func(t *testing.T) {
+		limits := newServerRateLimits(&Extensions{RateLimit: &RateLimitExtensions{
+			Server: &RateLimit{Requests: 1, Period: minute},
+			Tools:  map[string]RateLimit{"search": {Requests: 2, Period: minute}},
+		}})
+		now := time.Now()
+		limits.take("search", now)
+		if err := limits.take("search", now); err == nil {
+			t.Fatal("expected the server limit to reject the call")
+		}
+		if got := limits.tools["search"].tokens; got != 1 {
+			t.Errorf("expected the tool token to be given back, got %v tokens", got)
+		}
+	})
+
+	t.Run("Global limit", func(t *testing.T) {
+		limiter := NewRateLimiter(&RateLimitConfig{
+			Global:    &RateLimit{Requests: 1, Period: minute},
+			PerCaller: &RateLimit{Requests: 2, Period: minute},
+		})
+		now := time.Now()
+		limiter.take(alice, now)
+		if err := limiter.take(bob, now); err == nil {
+			t.Fatal("expected the global limit to reject the call")
+		}
+		if got := limiter.callers["caller:bob"].tokens; got != 2 {
+			t.Errorf("expected the caller token to be given back, got %v tokens", got)
+		}
+	})
+
+	t.Run("Proxy-wide limit", func(t *testing.T) {
+		server := NewServer(map[string]*MCPClient{}, false)
+		server.rateLimiter = NewRateLimiter(&RateLimitConfig{PerCaller: &RateLimit{Requests: 1, Period: minute}})
+		client := &MCPClient{rateLimits: newServerRateLimits(&Extensions{RateLimit: &RateLimitExtensions{
+			Server: &RateLimit{Requests: 2, Period: minute},
+		}})}
+		server.takeRateLimits(alice, client, "search")
+		if err := server.takeRateLimits(alice, client, "search"); err == nil {
+			t.Fatal("expected the caller limit to reject the call")
+		}
+		if got := client.rateLimits.server.tokens; got < 1 {
+			t.Errorf("expected the server token to be given back, got %v tokens", got)
+		}
+	})
+}
+
+func TestRateLimitedResponse(t *testing.T) {
+	server := newScopedTestServer(t, false)
+	server.authenticator = nil
+	server.rateLimiter = NewRateLimiter(&RateLimitConfig{
+		PerCaller: &RateLimit{Requests: 1, Period: Duration(time.Minute)},
+	})
+
+	call := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"tools/call","params":{"name":"search_docs"},"id":1}`))
+		w := httptest.NewRecorder()
+		server.handleJSONRPC(w, req)
+		return w
+	}
+
+	if w := call(); w.Code != http.StatusOK {
+		t.Fatalf("expected first call to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := call()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("expected Retry-After 60, got %q", got)
+	}
+	var resp JSONRPCResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Error == nil || resp.Error.Code != errCodeRateLimited {
+		t.Errorf("expected rate limit error, got %+v", resp)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultRedactionReplacement = "[REDACTED]"
+
+// Redactor hides secrets in tool arguments and results before they are
+// logged or recorded
+type Redactor struct {
+	paths       [][]string
+	keys        []string
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+// NewRedactor creates a redactor from the redaction config
+func NewRedactor(cfg *RedactionConfig) (*Redactor, error) {
+	r := &Redactor{replacement: cfg.Replacement}
+	if r.replacement == "" {
+		r.replacement = defaultRedactionReplacement
+	}
+
+	for _, p := range cfg.Paths {
+		segments := parseRedactionPath(p)
+		if len(segments) == 0 {
+			return nil, fmt.Errorf("invalid redaction path %q", p)
+		}
+		r.paths = append(r.paths, segments)
+	}
+	for _, key := range cfg.Keys {
+		key = strings.ToLower(key)
+		if _, err := path.Match(key, ""); err != nil {
+			return nil, fmt.Errorf("invalid redaction key pattern %q: %w", key, err)
+		}
+		r.keys = append(r.keys, key)
+	}
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// parseRedactionPath splits a path like "$.credentials[0].password" into its segments
+func parseRedactionPath(p string) []string {
+	p = strings.TrimPrefix(strings.TrimSpace(p), "$")
+	p = strings.NewReplacer("[", ".", "]", "").Replace(p)
+
+	var segments []string
+	for _, segment := range strings.Split(p, ".") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// redactArguments returns a redacted copy of the tool call arguments
+func (r *Redactor) redactArguments(args map[string]interface{}) map[string]interface{} {
+	if r == nil || args == nil {
+		return args
+	}
+	redacted, _ := r.redact(args, nil).(map[string]interface{})
+	return redacted
+}
+
+// redactValue returns a redacted copy of any JSON encodable value, such as a tool result
+func (r *Redactor) redactValue(v interface{}) interface{} {
+	if r == nil || v == nil {
+		return v
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return r.replacement
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return r.replacement
+	}
+	return r.redact(generic, nil)
+}
+
+// redactString redacts the parts of s that match a value pattern
+func (r *Redactor) redactString(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, r.replacement)
+	}
+	return s
+}
+
+func (r *Redactor) redact(v interface{}, at []string) interface{} {
+	if r.matchesPath(at) {
+		return r.replacement
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			if r.matchesKey(k) {
+				out[k] = r.replacement
+				continue
+			}
+			out[k] = r.redact(item, append(at[:len(at):len(at)], k))
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, item := range value {
+			out[i] = r.redact(item, append(at[:len(at):len(at)], strconv.Itoa(i)))
+		}
+		return out
+	case string:
+		return r.redactString(value)
+	default:
+		return v
+	}
+}
+
+func (r *Redactor) matchesPath(at []string) bool {
+	if len(at) == 0 {
+		return false
+	}
+	for _, p := range r.paths {
+		if len(p) != len(at) {
+			continue
+		}
+		matched := true
+		for i, segment := range p {
+			if segment != "*" && segment != at[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) matchesKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, pattern := range r.keys {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultConfigWatchInterval = 2 * time.Second
+
+// ReloadClients applies the server configs to the running servers. New
+// servers are started and removed ones stopped. Servers whose connection
+// settings changed are restarted; other changes are applied in place.
+func (s *Server) ReloadClients(ctx context.Context, configs map[string]*MCPClientConfig) {
+	s.manageMu.Lock()
+	defer s.manageMu.Unlock()
+
+	s.initMu.RLock()
+	current := make(map[string]*upstreamState, len(s.upstreams))
+	for name, state := range s.upstreams {
+		current[name] = state
+	}
+	s.initMu.RUnlock()
+
+	for name := range current {
+		if _, ok := configs[name]; !ok {
+			s.removeClient(name)
+			s.initMu.Lock()
+			delete(s.upstreams, name)
+			s.initMu.Unlock()
+			s.logger.InfoContext(ctx, "MCP server removed", "server_name", name)
+		}
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := s.reloadClient(ctx, name, current[name], configs[name]); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to reload MCP server", "server_name", name, "error", s.redactor.redactString(err.Error()))
+		}
+	}
+}
+
+// reloadClient applies the config of one server. state is nil for new servers.
+func (s *Server) reloadClient(ctx context.Context, name string, state *upstreamState, cfg *MCPClientConfig) error {
+	disabled := cfg.Extensions != nil && cfg.Extensions.Disabled
+	if state == nil {
+		state = &upstreamState{config: cfg, disabled: disabled}
+		s.initMu.Lock()
+		s.upstreams[name] = state
+		s.initMu.Unlock()
+		if disabled {
+			return nil
+		}
+		s.logger.InfoContext(ctx, "Starting added MCP server", "server_name", name)
+		return s.replaceClient(ctx, name, state)
+	}
+
+	s.initMu.Lock()
+	previous := state.config
+	wasDisabled := previous.Extensions != nil && previous.Extensions.Disabled
+	running := s.mcpClients[name]
+	state.config = cfg
+	if disabled != wasDisabled {
+		state.disabled = disabled
+	}
+	s.initMu.Unlock()
+
+	switch {
+	case reflect.DeepEqual(previous, cfg):
+		return nil
+	case disabled && !wasDisabled:
+		s.removeClient(name)
+		s.logger.InfoContext(ctx, "MCP server disabled by config", "server_name", name)
+		return nil
+	case state.disabled:
+		// Disabled by the config or the admin API; the config applies once enabled
+		return nil
+	case running == nil || !reflect.DeepEqual(connectionSettings(previous), connectionSettings(cfg)):
+		s.logger.InfoContext(ctx, "Restarting changed MCP server", "server_name", name)
+		if err := s.replaceClient(ctx, name, state); err != nil {
+			return err
+		}
+		s.metrics.observeUpstreamRestart(name)
+		return nil
+	}
+
+	client, err := running.reconfigure(cfg)
+	if err != nil {
+		return err
+	}
+	s.initMu.Lock()
+	s.mcpClients = withClient(s.mcpClients, name, client)
+	s.initMu.Unlock()
+	s.flushToolsCache(name)
+	s.logger.InfoContext(ctx, "MCP server reconfigured in place", "server_name", name)
+	return nil
+}
+
+// connectionSettings returns the settings of a server that are fixed when its
+// client connects, so that changing them requires a restart
+func connectionSettings(cfg *MCPClientConfig) []interface{} {
+	var ext Extensions
+	if cfg.Extensions != nil {
+		ext = *cfg.Extensions
+	}
+	return []interface{}{cfg.Command, cfg.Args, cfg.Env, cfg.Url, cfg.Headers, cfg.OAuth, ext.Sse, ext.Forward, ext.Stderr}
+}
+
+// reconfigure returns a client with the settings of config that shares the
+// connection to the server with c. The connection settings of config must be
+// the ones of c. Limiters and the circuit breaker keep their state unless
+// their settings changed.
+func (c *MCPClient) reconfigure(config *MCPClientConfig) (*MCPClient, error) {
+	outputFilter, err := newServerOutputFilters(config.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output filter: %w", err)
+	}
+	resultLimits, err := newServerResultLimits(config.Extensions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid result limit: %w", err)
+	}
+
+	updated := &MCPClient{
+		config:       config,
+		client:       c.client,
+		logger:       c.logger,
+		stderrCancel: c.stderrCancel,
+		stderrDone:   c.stderrDone,
+		breaker:      c.breaker,
+		limiter:      c.limiter,
+		rateLimits:   c.rateLimits,
+		outputFilter: outputFilter,
+		resultLimits: resultLimits,
+		stderr:       c.stderr,
+		startedAt:    c.startedAt,
+		health:       c.health,
+		redactor:     c.redactor,
+	}
+
+	var ext, previous Extensions
+	if config.Extensions != nil {
+		ext = *config.Extensions
+	}
+	if c.config.Extensions != nil {
+		previous = *c.config.Extensions
+	}
+	if ext.MaxConcurrent != previous.MaxConcurrent || ext.QueueSize != previous.QueueSize || ext.QueueTimeout != previous.QueueTimeout {
+		updated.limiter = newConcurrencyLimiter(config.Extensions, c.logger)
+	}
+	if !reflect.DeepEqual(ext.RateLimit, previous.RateLimit) {
+		updated.rateLimits = newServerRateLimits(config.Extensions)
+	}
+	if (config.Extensions == nil) != (c.config.Extensions == nil) || !reflect.DeepEqual(ext.CircuitBreaker, previous.CircuitBreaker) {
+		updated.breaker = nil
+		if config.Extensions != nil {
+			updated.breaker = newCircuitBreaker(config.Extensions.CircuitBreaker, c.logger)
+		}
+	}
+
+	c.idempotentMu.RLock()
+	updated.idempotentTools = c.idempotentTools
+	updated.knownTools = c.knownTools
+	c.idempotentMu.RUnlock()
+	return updated, nil
+}
+
+// changedSections returns the top-level config sections other than
+// mcpServers that differ, which only take effect on restart
+func changedSections(running, loaded *Config) []string {
+	var changed []string
+	a, b := reflect.ValueOf(*running), reflect.ValueOf(*loaded)
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if field.Name == "MCPServers" {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, strings.Split(field.Tag.Get("yaml"), ",")[0])
+		}
+	}
+	return changed
+}
+
+// watchConfigFile calls onChange when the contents of the file change, until
+// ctx is done
+func watchConfigFile(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	last := fileChecksum(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checksum := fileChecksum(path)
+			if checksum == "" || checksum == last {
+				continue
+			}
+			last = checksum
+			onChange()
+		}
+	}
+}
+
+// fileChecksum returns the SHA-256 checksum of the file, or "" if it cannot be read
+func fileChecksum(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
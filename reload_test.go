@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConnectionSettings(t *testing.T) {
+	base := func() *MCPClientConfig {
+		return &MCPClientConfig{
+			Command:    "server",
+			Args:       []string{"--stdio"},
+			Env:        map[string]string{"TOKEN": "a"},
+			Extensions: &Extensions{Tools: ToolsExtensions{Allow: []string{"read"}}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		change  func(cfg *MCPClientConfig)
+		restart bool
+	}{
+		{name: "Unchanged", change: func(cfg *MCPClientConfig) {}},
+		{name: "Allow list", change: func(cfg *MCPClientConfig) { cfg.Extensions.Tools.Allow = []string{"write"} }},
+		{name: "Timeout", change: func(cfg *MCPClientConfig) { cfg.Extensions.Timeout = Duration(time.Second) }},
+		{name: "Rate limit", change: func(cfg *MCPClientConfig) { cfg.Extensions.RateLimit = &RateLimitExtensions{} }},
+		{name: "Command", change: func(cfg *MCPClientConfig) { cfg.Command = "other" }, restart: true},
+		{name: "Args", change: func(cfg *MCPClientConfig) { cfg.Args = nil }, restart: true},
+		{name: "Env", change: func(cfg *MCPClientConfig) { cfg.Env["TOKEN"] = "b" }, restart: true},
+		{name: "URL", change: func(cfg *MCPClientConfig) { cfg.Url = "http://localhost" }, restart: true},
+		{name: "SSE", change: func(cfg *MCPClientConfig) { cfg.Extensions.Sse = true }, restart: true},
+		{name: "Forwarded headers", change: func(cfg *MCPClientConfig) { cfg.Extensions.Forward = &ForwardExtensions{} }, restart: true},
+		{name: "Stderr format", change: func(cfg *MCPClientConfig) { cfg.Extensions.Stderr = &StderrExtensions{Format: "json"} }, restart: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := base()
+			tt.change(changed)
+			restart := !reflect.DeepEqual(connectionSettings(base()), connectionSettings(changed))
+			if restart != tt.restart {
+				t.Errorf("restart = %v, want %v", restart, tt.restart)
+			}
+		})
+	}
+}
+
+func TestReloadClients(t *testing.T) {
+	url, otherURL := newTestUpstream(t), newTestUpstream(t)
+	server := newManagedTestServer(t, map[string]*MCPClientConfig{
+		"filtered":  {Name: "filtered", Url: url},
+		"removed":   {Name: "removed", Url: url},
+		"moved":     {Name: "moved", Url: url},
+		"unchanged": {Name: "unchanged", Url: url},
+		"disabled":  {Name: "disabled", Url: url},
+	})
+	before := server.clients()
+
+	server.ReloadClients(context.Background(), map[string]*MCPClientConfig{
+		"filtered":  {Name: "filtered", Url: url, Extensions: &Extensions{Tools: ToolsExtensions{Deny: []string{"ping"}}}},
+		"moved":     {Name: "moved", Url: otherURL},
+		"unchanged": {Name: "unchanged", Url: url},
+		"disabled":  {Name: "disabled", Url: url, Extensions: &Extensions{Disabled: true}},
+		"added":     {Name: "added", Url: url},
+	})
+	after := server.clients()
+
+	if _, ok := after["removed"]; ok {
+		t.Error("expected the removed server to be stopped")
+	}
+	if _, ok := after["disabled"]; ok {
+		t.Error("expected the disabled server to be stopped")
+	}
+	if _, ok := after["added"]; !ok {
+		t.Error("expected the added server to be started")
+	}
+	if after["unchanged"] != before["unchanged"] {
+		t.Error("expected the unchanged server to keep its client")
+	}
+	if after["moved"] == nil || after["moved"].client == before["moved"].client || after["moved"].config.Url != otherURL {
+		t.Error("expected the server with a new URL to be restarted")
+	}
+
+	// Filter changes are applied without reconnecting
+	filtered := after["filtered"]
+	if filtered == nil || filtered.client != before["filtered"].client {
+		t.Fatal("expected the filtered server to keep its connection")
+	}
+	tools, err := filtered.ListTools(context.Background())
+	if err != nil || len(tools) != 0 {
+		t.Errorf("expected the denied tool to be filtered, got %v, %v", tools, err)
+	}
+
+	statuses := serverStatuses(t, server)
+	if _, ok := statuses["removed"]; ok {
+		t.Error("expected the removed server not to be listed")
+	}
+	if statuses["disabled"].Status != upstreamStatusDisabled {
+		t.Errorf("expected the disabled server to be listed as disabled, got %+v", statuses["disabled"])
+	}
+}
+
+func TestReloadKeepsAdminDisabledServers(t *testing.T) {
+	url := newTestUpstream(t)
+	server := newManagedTestServer(t, map[string]*MCPClientConfig{"up": {Name: "up", Url: url}})
+	if err := server.DisableServer(context.Background(), "up"); err != nil {
+		t.Fatalf("DisableServer failed: %v", err)
+	}
+
+	server.ReloadClients(context.Background(), map[string]*MCPClientConfig{
+		"up": {Name: "up", Url: url, Extensions: &Extensions{Timeout: Duration(time.Second)}},
+	})
+	if _, ok := server.clients()["up"]; ok {
+		t.Error("expected the server disabled through the admin API to stay disabled")
+	}
+
+	if err := server.EnableServer(context.Background(), "up"); err != nil {
+		t.Fatalf("EnableServer failed: %v", err)
+	}
+	if client := server.clients()["up"]; client == nil || client.requestTimeout() != time.Second {
+		t.Error("expected the enabled server to use the reloaded config")
+	}
+}
+
+func TestChangedSections(t *testing.T) {
+	running := &Config{MCPServers: map[string]ServerConfig{"a": {}}, IdentityHeader: "X-User"}
+	loaded := &Config{
+		MCPServers:     map[string]ServerConfig{"b": {}},
+		IdentityHeader: "X-Caller",
+		Policy:         &PolicyConfig{Default: "deny"},
+	}
+
+	got := changedSections(running, loaded)
+	want := []string{"identityHeader", "policy"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changedSections() = %v, want %v", got, want)
+	}
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("mcpServers: {}"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	changes := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchConfigFile(ctx, path, 10*time.Millisecond, func() { changes <- struct{}{} })
+
+	// Rewriting the same contents is not a change
+	time.Sleep(30 * time.Millisecond)
+	os.WriteFile(path, []byte("mcpServers: {}"), 0644)
+	time.Sleep(30 * time.Millisecond)
+	if len(changes) != 0 {
+		t.Fatal("expected no change for the same contents")
+	}
+
+	os.WriteFile(path, []byte("mcpServers:\n  a:\n    command: a"), 0644)
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a change")
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts        = 3
+	defaultRetryInitialBackoff     = 200 * time.Millisecond
+	defaultRetryMaxBackoff         = 5 * time.Second
+	defaultCircuitOpenTimeout      = 30 * time.Second
+	defaultCircuitHalfOpenRequests = 1
+)
+
+// maxAttempts returns the configured number of attempts or the default
+func (r *RetryExtensions) maxAttempts() int {
+	if r == nil {
+		return 1
+	}
+	if r.MaxAttempts <= 0 {
+		return defaultRetryMaxAttempts
+	}
+	return r.MaxAttempts
+}
+
+// backoff returns the wait time before the given retry (1 = first retry)
+func (r *RetryExtensions) backoff(retry int) time.Duration {
+	initial := time.Duration(r.InitialBackoff)
+	if initial <= 0 {
+		initial = defaultRetryInitialBackoff
+	}
+	maxBackoff := time.Duration(r.MaxBackoff)
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+
+	backoff := float64(initial) * math.Pow(2, float64(retry-1))
+	if backoff > float64(maxBackoff) {
+		return maxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops sending requests to an upstream that keeps failing.
+// After openTimeout it lets a limited number of probe requests through and
+// closes again on the first successful one.
+type circuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	halfOpenMax int
+	logger      *slog.Logger
+	now         func() time.Time
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// newCircuitBreaker creates a circuit breaker, or returns nil if it is not configured
+func newCircuitBreaker(cfg *CircuitBreakerExtensions, logger *slog.Logger) *circuitBreaker {
+	if cfg == nil || cfg.FailureThreshold <= 0 {
+		return nil
+	}
+
+	openTimeout := time.Duration(cfg.OpenTimeout)
+	if openTimeout <= 0 {
+		openTimeout = defaultCircuitOpenTimeout
+	}
+	halfOpenMax := cfg.HalfOpenRequests
+	if halfOpenMax <= 0 {
+		halfOpenMax = defaultCircuitHalfOpenRequests
+	}
+
+	return &circuitBreaker{
+		threshold:   cfg.FailureThreshold,
+		openTimeout: openTimeout,
+		halfOpenMax: halfOpenMax,
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// allow reports whether a request may be sent. If not, it also returns
+// how long the circuit is expected to stay open.
+func (b *circuitBreaker) allow() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed < b.openTimeout {
+			return b.openTimeout - elapsed, false
+		}
+		b.setState(circuitHalfOpen)
+		b.probes = 1
+		return 0, true
+	case circuitHalfOpen:
+		if b.probes >= b.halfOpenMax {
+			return 0, false
+		}
+		b.probes++
+		return 0, true
+	default:
+		return 0, true
+	}
+}
+
+// done records the outcome of a request that was allowed by allow.
+// Cancellation by the caller says nothing about the upstream and is not counted.
+func (b *circuitBreaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+
+	switch {
+	case err != nil && errors.Is(err, context.Canceled):
+		return
+	case err == nil:
+		b.failures = 0
+		if b.state == circuitHalfOpen {
+			b.setState(circuitClosed)
+		}
+	default:
+		b.failures++
+		if b.state == circuitHalfOpen || (b.state == circuitClosed && b.failures >= b.threshold) {
+			b.openedAt = b.now()
+			b.setState(circuitOpen)
+		}
+	}
+}
+
+// State returns the current state of the circuit
+func (b *circuitBreaker) State() circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) setState(state circuitState) {
+	if b.state == state {
+		return
+	}
+	b.logger.Warn("Circuit breaker state changed",
+		"from", b.state.String(),
+		"to", state.String(),
+		"consecutive_failures", b.failures)
+	b.state = state
+}
+
+// newCircuitOpenError creates the JSON-RPC error returned while the circuit is open
+func newCircuitOpenError(retryAfter time.Duration) *rpcError {
+	return &rpcError{
+		code:    errCodeUpstreamUnavailable,
+		message: "Upstream server unavailable",
+		data: map[string]interface{}{
+			"reason":            "circuit breaker open",
+			"retryAfterSeconds": int(math.Ceil(retryAfter.Seconds())),
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	retry := &RetryExtensions{
+		InitialBackoff: Duration(100 * time.Millisecond),
+		MaxBackoff:     Duration(500 * time.Millisecond),
+	}
+
+	tests := []struct {
+		retry    int
+		expected time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 500 * time.Millisecond}, // capped
+	}
+
+	for _, tt := range tests {
+		if got := retry.backoff(tt.retry); got != tt.expected {
+			t.Errorf("backoff(%d) = %v, want %v", tt.retry, got, tt.expected)
+		}
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	var nilRetry *RetryExtensions
+	if got := nilRetry.maxAttempts(); got != 1 {
+		t.Errorf("nil retry policy: expected 1 attempt, got %d", got)
+	}
+	if got := (&RetryExtensions{}).maxAttempts(); got != defaultRetryMaxAttempts {
+		t.Errorf("empty retry policy: expected %d attempts, got %d", defaultRetryMaxAttempts, got)
+	}
+	if got := (&RetryExtensions{MaxAttempts: 5}).maxAttempts(); got != 5 {
+		t.Errorf("expected 5 attempts, got %d", got)
+	}
+}
+
+func TestNewCircuitBreakerDisabled(t *testing.T) {
+	if b := newCircuitBreaker(nil, WithComponent("test")); b != nil {
+		t.Error("circuit breaker should be disabled without config")
+	}
+	if b := newCircuitBreaker(&CircuitBreakerExtensions{}, WithComponent("test")); b != nil {
+		t.Error("circuit breaker should be disabled with zero failure threshold")
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(&CircuitBreakerExtensions{
+		FailureThreshold: 2,
+		OpenTimeout:      Duration(10 * time.Second),
+	}, WithComponent("test"))
+	b.now = func() time.Time { return now }
+
+	upstreamErr := errors.New("connection refused")
+
+	// Failures below the threshold keep the circuit closed
+	if _, ok := b.allow(); !ok {
+		t.Fatal("closed circuit should allow requests")
+	}
+	b.done(upstreamErr)
+	if b.State() != circuitClosed {
+		t.Fatalf("expected closed after 1 failure, got %s", b.State())
+	}
+
+	// Reaching the threshold opens the circuit
+	b.allow()
+	b.done(upstreamErr)
+	if b.State() != circuitOpen {
+		t.Fatalf("expected open after 2 failures, got %s", b.State())
+	}
+
+	retryAfter, ok := b.allow()
+	if ok {
+		t.Fatal("open circuit should reject requests")
+	}
+	if retryAfter != 10*time.Second {
+		t.Errorf("expected retry after 10s, got %v", retryAfter)
+	}
+
+	// After the open timeout a single probe is let through
+	now = now.Add(11 * time.Second)
+	if _, ok := b.allow(); !ok {
+		t.Fatal("half-open circuit should allow a probe")
+	}
+	if b.State() != circuitHalfOpen {
+		t.Fatalf("expected half-open, got %s", b.State())
+	}
+	if _, ok := b.allow(); ok {
+		t.Error("half-open circuit should reject requests beyond the probe limit")
+	}
+
+	// A failed probe opens the circuit again
+	b.done(upstreamErr)
+	if b.State() != circuitOpen {
+		t.Fatalf("expected open after failed probe, got %s", b.State())
+	}
+
+	// A successful probe closes it
+	now = now.Add(11 * time.Second)
+	b.allow()
+	b.done(nil)
+	if b.State() != circuitClosed {
+		t.Fatalf("expected closed after successful probe, got %s", b.State())
+	}
+}
+
+func TestCircuitBreakerIgnoresCancellation(t *testing.T) {
+	b := newCircuitBreaker(&CircuitBreakerExtensions{FailureThreshold: 1}, WithComponent("test"))
+
+	b.allow()
+	b.done(context.Canceled)
+	if b.State() != circuitClosed {
+		t.Errorf("cancelled requests should not open the circuit, got %s", b.State())
+	}
+}
+
+func TestCircuitOpenError(t *testing.T) {
+	err := newCircuitOpenError(1500 * time.Millisecond)
+	if err.code != errCodeUpstreamUnavailable {
+		t.Errorf("expected code %d, got %d", errCodeUpstreamUnavailable, err.code)
+	}
+	data := err.data.(map[string]interface{})
+	if data["retryAfterSeconds"] != 2 {
+		t.Errorf("expected retryAfterSeconds 2, got %v", data["retryAfterSeconds"])
+	}
+}
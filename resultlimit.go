@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// Default maximum size of request bodies
+	defaultMaxRequestBytes = 10 << 20
+
+	resultLimitTruncate = "truncate"
+	resultLimitError    = "error"
+)
+
+// serverResultLimits holds the result size limits of one server
+type serverResultLimits struct {
+	server *ResultLimit
+	tools  map[string]ResultLimit
+}
+
+// newServerResultLimits validates the result size limits of the server. It
+// returns nil if the server has none.
+func newServerResultLimits(ext *Extensions) (*serverResultLimits, error) {
+	if ext == nil || ext.ResultLimit == nil {
+		return nil, nil
+	}
+	if ext.ResultLimit.Server != nil {
+		if err := validateResultLimit(ext.ResultLimit.Server); err != nil {
+			return nil, err
+		}
+	}
+	for name, limit := range ext.ResultLimit.Tools {
+		if err := validateResultLimit(&limit); err != nil {
+			return nil, fmt.Errorf("tool %s: %w", name, err)
+		}
+	}
+	return &serverResultLimits{server: ext.ResultLimit.Server, tools: ext.ResultLimit.Tools}, nil
+}
+
+func validateResultLimit(limit *ResultLimit) error {
+	if limit.MaxBytes <= 0 {
+		return fmt.Errorf("maxBytes must be positive")
+	}
+	switch limit.Action {
+	case "", resultLimitTruncate, resultLimitError:
+		return nil
+	default:
+		return fmt.Errorf("invalid action %q", limit.Action)
+	}
+}
+
+// apply enforces the limit of the tool, or else the server limit, on the result
+func (l *serverResultLimits) apply(toolName string, result *mcp.CallToolResult) *mcp.CallToolResult {
+	if l == nil || result == nil {
+		return result
+	}
+	limit, ok := l.tools[toolName]
+	if !ok {
+		if l.server == nil {
+			return result
+		}
+		limit = *l.server
+	}
+
+	size := resultSize(result)
+	if size <= limit.MaxBytes {
+		return result
+	}
+	if limit.Action == resultLimitError {
+		return mcp.NewToolResultError(fmt.Sprintf("Tool result of %d bytes exceeds the limit of %d bytes", size, limit.MaxBytes))
+	}
+	return truncateResult(result, limit.MaxBytes, size)
+}
+
+// resultSize returns the size of the text and data in the result content
+func resultSize(result *mcp.CallToolResult) int {
+	size := 0
+	for _, content := range result.Content {
+		size += contentSize(content)
+	}
+	return size
+}
+
+func contentSize(content mcp.Content) int {
+	switch c := content.(type) {
+	case mcp.TextContent:
+		return len(c.Text)
+	case *mcp.TextContent:
+		return len(c.Text)
+	case mcp.ImageContent:
+		return len(c.Data)
+	case *mcp.ImageContent:
+		return len(c.Data)
+	case mcp.AudioContent:
+		return len(c.Data)
+	case *mcp.AudioContent:
+		return len(c.Data)
+	case mcp.EmbeddedResource:
+		return resourceSize(c.Resource)
+	case *mcp.EmbeddedResource:
+		return resourceSize(c.Resource)
+	default:
+		return 0
+	}
+}
+
+func resourceSize(resource mcp.ResourceContents) int {
+	switch r := resource.(type) {
+	case mcp.TextResourceContents:
+		return len(r.Text)
+	case *mcp.TextResourceContents:
+		return len(r.Text)
+	case mcp.BlobResourceContents:
+		return len(r.Blob)
+	case *mcp.BlobResourceContents:
+		return len(r.Blob)
+	default:
+		return 0
+	}
+}
+
+// truncateResult keeps the content that fits into maxBytes. The text content
+// that crosses the limit is cut, later content is dropped, and a marker tells
+// the reader that the result is incomplete.
+func truncateResult(result *mcp.CallToolResult, maxBytes, size int) *mcp.CallToolResult {
+	truncated := *result
+	truncated.Content = make([]mcp.Content, 0, len(result.Content)+1)
+
+	budget := maxBytes
+	for _, content := range result.Content {
+		n := contentSize(content)
+		if n <= budget {
+			truncated.Content = append(truncated.Content, content)
+			budget -= n
+			continue
+		}
+		if text, ok := textOf(content); ok && budget > 0 {
+			truncated.Content = append(truncated.Content, mcp.NewTextContent(truncateUTF8(text, budget)))
+		}
+		break
+	}
+
+	truncated.Content = append(truncated.Content, mcp.NewTextContent(
+		fmt.Sprintf("[truncated: the result of %d bytes exceeded the limit of %d bytes]", size, maxBytes)))
+	return &truncated
+}
+
+func textOf(content mcp.Content) (string, bool) {
+	switch c := content.(type) {
+	case mcp.TextContent:
+		return c.Text, true
+	case *mcp.TextContent:
+		return c.Text, true
+	default:
+		return "", false
+	}
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestNewServerResultLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		ext     *Extensions
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "No extensions", wantNil: true},
+		{name: "No result limit", ext: &Extensions{}, wantNil: true},
+		{name: "Valid limits", ext: &Extensions{ResultLimit: &ResultLimitExtensions{
+			Server: &ResultLimit{MaxBytes: 1000},
+			Tools:  map[string]ResultLimit{"dump": {MaxBytes: 10, Action: "error"}},
+		}}},
+		{name: "Missing maxBytes", ext: &Extensions{ResultLimit: &ResultLimitExtensions{
+			Server: &ResultLimit{Action: "truncate"},
+		}}, wantErr: true},
+		{name: "Invalid action", ext: &Extensions{ResultLimit: &ResultLimitExtensions{
+			Tools: map[string]ResultLimit{"dump": {MaxBytes: 10, Action: "drop"}},
+		}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newServerResultLimits(tt.ext)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newServerResultLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (l == nil) != tt.wantNil {
+				t.Errorf("newServerResultLimits() = %v, wantNil %v", l, tt.wantNil)
+			}
+		})
+	}
+}
+
+// contentTexts returns the text of each content, or its type for other content
+func contentTexts(result *mcp.CallToolResult) []string {
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := textOf(content); ok {
+			texts = append(texts, text)
+		} else {
+			contentType, _ := describeContent(content)
+			texts = append(texts, "<"+contentType+">")
+		}
+	}
+	return texts
+}
+
+func TestResultLimitApply(t *testing.T) {
+	limits, err := newServerResultLimits(&Extensions{ResultLimit: &ResultLimitExtensions{
+		Server: &ResultLimit{MaxBytes: 10},
+		Tools: map[string]ResultLimit{
+			"strict": {MaxBytes: 4, Action: "error"},
+			"large":  {MaxBytes: 100},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("newServerResultLimits failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		tool    string
+		content []mcp.Content
+		want    []string
+		isError bool
+	}{
+		{
+			name:    "Within server limit",
+			tool:    "any",
+			content: []mcp.Content{mcp.NewTextContent("0123456789")},
+			want:    []string{"0123456789"},
+		},
+		{
+			name:    "Text cut at the limit",
+			tool:    "any",
+			content: []mcp.Content{mcp.NewTextContent("0123"), mcp.NewTextContent("456789abcdef"), mcp.NewTextContent("rest")},
+			want:    []string{"0123", "456789", "[truncated: the result of 20 bytes exceeded the limit of 10 bytes]"},
+		},
+		{
+			name:    "Content that cannot be cut is dropped",
+			tool:    "any",
+			content: []mcp.Content{mcp.NewTextContent("01"), mcp.NewImageContent("aW1hZ2VkYXRh", "image/png")},
+			want:    []string{"01", "[truncated: the result of 14 bytes exceeded the limit of 10 bytes]"},
+		},
+		{
+			name:    "Multi-byte characters are not split",
+			tool:    "any",
+			content: []mcp.Content{mcp.NewTextContent("ああああ")},
+			want:    []string{"あああ", "[truncated: the result of 12 bytes exceeded the limit of 10 bytes]"},
+		},
+		{
+			name:    "Tool limit replaces server limit",
+			tool:    "large",
+			content: []mcp.Content{mcp.NewTextContent(strings.Repeat("x", 50))},
+			want:    []string{strings.Repeat("x", 50)},
+		},
+		{
+			name:    "Error action",
+			tool:    "strict",
+			content: []mcp.Content{mcp.NewTextContent("01234")},
+			want:    []string{"Tool result of 5 bytes exceeds the limit of 4 bytes"},
+			isError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := limits.apply(tt.tool, &mcp.CallToolResult{Content: tt.content})
+			if got := strings.Join(contentTexts(result), "|"); got != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, strings.Join(tt.want, "|"))
+			}
+			if result.IsError != tt.isError {
+				t.Errorf("isError = %v, want %v", result.IsError, tt.isError)
+			}
+		})
+	}
+}
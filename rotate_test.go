@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w, err := newRotatingWriter(path, 1, 2)
+	if err != nil {
+		t.Fatalf("newRotatingWriter failed: %v", err)
+	}
+	defer w.Close()
+	// Use a small size so that the test does not write megabytes
+	w.maxSize = 10
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "gggg\n",
+		path + ".1": "eeee\nffff\n",
+		path + ".2": "cccc\ndddd\n",
+	}
+	for file, content := range expected {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only %d backups to be kept", w.maxBackups)
+	}
+}
+
+func TestRotatingWriterAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte("existing\n"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	w, err := newRotatingWriter(path, 0, 0)
+	if err != nil {
+		t.Fatalf("newRotatingWriter failed: %v", err)
+	}
+	w.Write([]byte("new\n"))
+	w.Close()
+
+	got, _ := os.ReadFile(path)
+	if string(got) != "existing\nnew\n" {
+		t.Errorf("expected the file to be appended to, got %q", got)
+	}
+	if _, err := w.Write([]byte("closed\n")); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("expected write after close to fail, got %v", err)
+	}
+}
@@ -2,17 +2,27 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -20,6 +30,15 @@ const (
 	defaultRequestTimeout = 60 * time.Second
 )
 
+// JSON-RPC error codes returned by the proxy itself (implementation-defined server error range)
+const (
+	errCodeUpstreamUnavailable = -32001
+	errCodeServerBusy          = -32002
+	errCodeForbidden           = -32003
+	errCodeApprovalRejected    = -32004
+	errCodeRateLimited         = -32005
+)
+
 type JSONRPCRequest struct {
 	JSONRPC string                 `json:"jsonrpc"`
 	Method  string                 `json:"method"`
@@ -38,6 +57,35 @@ type JSONRPCResponse struct {
 	ID interface{} `json:"id"`
 }
 
+// rpcError is an error that is reported to the client with its own JSON-RPC code and message
+// instead of the generic "Internal error"
+type rpcError struct {
+	code    int
+	message string
+	data    interface{}
+
+	// HTTP status of the response (default: 200) and the Retry-After header, if set
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *rpcError) Error() string {
+	if e.data != nil {
+		return fmt.Sprintf("%s: %v", e.message, e.data)
+	}
+	return e.message
+}
+
+// httpError is an error that is reported to the client with a specific HTTP status
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
 // MCPClientInterface defines the interface for MCP clients
 type MCPClientInterface interface {
 	ListTools(ctx context.Context) ([]mcp.Tool, error)
@@ -46,58 +94,210 @@ type MCPClientInterface interface {
 
 // Server represents an HTTP server
 type Server struct {
+	// Running MCP clients by server name. The map is replaced under initMu,
+	// never modified, so a snapshot from clients() stays valid.
 	mcpClients map[string]*MCPClient
 	splitMode  bool
 	initMu     sync.RWMutex
 	server     *http.Server
 	logger     *slog.Logger
 
+	// Runtime state of all configured MCP servers, guarded by initMu
+	upstreams map[string]*upstreamState
+	// Serializes starting, restarting, enabling and disabling servers
+	manageMu    sync.Mutex
+	initTimeout time.Duration
+
+	// While draining, new requests are rejected and readiness fails
+	draining atomic.Bool
+	inFlight atomic.Int64
+
 	// Cache for tools (flat mode only)
 	toolsCache  map[string][]mcp.Tool
 	cacheExpiry map[string]time.Time
 	cacheMu     sync.RWMutex
+
+	// Header that carries the caller identity set by a trusted front proxy
+	identityHeader string
+	authenticator  *Authenticator
+
+	// TLS config of the listener; plain HTTP if nil
+	tlsConfig *tls.Config
+
+	policy      *PolicyEngine
+	approvals   *ApprovalManager
+	rateLimiter *RateLimiter
+	audit       *AuditLogger
+	redactor    *Redactor
+
+	// Maximum size of a request body in bytes
+	maxRequestBytes int64
+
+	metrics *Metrics
+
+	// Recent tool calls shown on the status page
+	recentCalls *callHistory
+
+	healthPolicy *HealthPolicy
+
+	// Bearer token of the admin API; the API is off if empty
+	adminToken string
+	// Listener of the admin API, built in NewServer so that Shutdown can
+	// stop it while StartAdmin is still starting it
+	adminServer *http.Server
+}
+
+// ServerOption configures optional features of the Server
+type ServerOption func(*Server)
+
+// WithIdentityHeader makes the server take the caller identity from the given request header
+func WithIdentityHeader(header string) ServerOption {
+	return func(s *Server) {
+		s.identityHeader = header
+	}
+}
+
+// WithAuthenticator requires incoming requests to be authenticated
+func WithAuthenticator(authenticator *Authenticator) ServerOption {
+	return func(s *Server) {
+		s.authenticator = authenticator
+	}
+}
+
+// WithTLS makes the server listen with TLS
+func WithTLS(config *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
+// WithPolicy authorizes tool calls with the given policy
+func WithPolicy(policy *PolicyEngine) ServerOption {
+	return func(s *Server) {
+		s.policy = policy
+	}
+}
+
+// WithApprovals holds calls to tools that require approval until an approver decides
+func WithApprovals(approvals *ApprovalManager) ServerOption {
+	return func(s *Server) {
+		s.approvals = approvals
+	}
+}
+
+// WithRateLimiter applies the proxy-wide rate limits to tool calls
+func WithRateLimiter(rateLimiter *RateLimiter) ServerOption {
+	return func(s *Server) {
+		s.rateLimiter = rateLimiter
+	}
+}
+
+// WithAuditLogger records every tool call in the audit log
+func WithAuditLogger(audit *AuditLogger) ServerOption {
+	return func(s *Server) {
+		s.audit = audit
+	}
+}
+
+// WithRedactor sets the redactor applied to tool arguments and results in debug logs
+func WithRedactor(redactor *Redactor) ServerOption {
+	return func(s *Server) {
+		s.redactor = redactor
+	}
+}
+
+// WithMaxRequestBytes sets the maximum size of request bodies. Non-positive
+// values keep the default.
+func WithMaxRequestBytes(n int64) ServerOption {
+	return func(s *Server) {
+		if n > 0 {
+			s.maxRequestBytes = n
+		}
+	}
 }
 
 // NewServer creates a new server with the specified MCP clients and mode
-func NewServer(mcpClients map[string]*MCPClient, splitMode bool) *Server {
-	return &Server{
+func NewServer(mcpClients map[string]*MCPClient, splitMode bool, opts ...ServerOption) *Server {
+	s := &Server{
 		mcpClients:  mcpClients,
 		splitMode:   splitMode,
 		logger:      WithComponent("server"),
 		toolsCache:  make(map[string][]mcp.Tool),
 		cacheExpiry: make(map[string]time.Time),
+		upstreams:   make(map[string]*upstreamState),
+		initTimeout: defaultInitTimeout,
+
+		maxRequestBytes: defaultMaxRequestBytes,
+		metrics:         NewMetrics(),
+		recentCalls:     newCallHistory(defaultRecentCalls),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.adminServer = &http.Server{Handler: s.adminRoutes()}
+	return s
+}
+
+// clients returns the running MCP clients
+func (s *Server) clients() map[string]*MCPClient {
+	s.initMu.RLock()
+	defer s.initMu.RUnlock()
+	return s.mcpClients
 }
 
+const (
+	requestIDHeader    = "X-Request-Id"
+	maxRequestIDLength = 128
+)
+
 // ModeHandler defines the interface for mode-specific handling
 type ModeHandler interface {
-	validateRequest(r *http.Request) (*slog.Logger, error)
+	validateRequest(r *http.Request) (*Caller, *slog.Logger, error)
 	handleToolsList(ctx context.Context) (interface{}, error)
 	handleToolsCall(ctx context.Context, params map[string]interface{}) (interface{}, error)
 }
 
 // SplitModeHandler handles requests in split mode
 type SplitModeHandler struct {
-	server    *Server
-	mcpClient *MCPClient
-	logger    *slog.Logger
+	server     *Server
+	serverName string
+	mcpClient  *MCPClient
+	logger     *slog.Logger
 }
 
 // FlatModeHandler handles requests in flat mode
 type FlatModeHandler struct {
-	server *Server
-	logger *slog.Logger
+	server  *Server
+	clients map[string]*MCPClient
+	logger  *slog.Logger
 }
 
 // handleJSONRPC routes requests to the appropriate handler based on server mode
 func (s *Server) handleJSONRPC(w http.ResponseWriter, r *http.Request) {
+	defer s.metrics.trackInFlight()()
+
+	requestID := requestIDFromHeader(r.Header)
+	w.Header().Set(requestIDHeader, requestID)
+	r = r.WithContext(withRequestID(r.Context(), requestID))
+
+	// Counted before checking draining, so that a drain that starts meanwhile
+	// waits for the request
+	s.inFlight.Add(1)
+	if s.draining.Load() {
+		s.inFlight.Add(-1)
+		http.Error(w, "Server is draining", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.inFlight.Add(-1)
+
+	clients := s.clients()
 	var handler ModeHandler
 	var err error
 
 	if s.splitMode {
-		handler, err = s.createSplitModeHandler(r)
+		handler, err = s.createSplitModeHandler(r, clients)
 	} else {
-		handler, err = s.createFlatModeHandler(r)
+		handler, err = s.createFlatModeHandler(r, clients)
 	}
 
 	if err != nil {
@@ -105,11 +305,11 @@ func (s *Server) handleJSONRPC(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.processRequest(w, r, handler)
+	s.processRequest(w, r, handler, len(clients) > 0)
 }
 
 // createSplitModeHandler creates a handler for split mode requests
-func (s *Server) createSplitModeHandler(r *http.Request) (ModeHandler, error) {
+func (s *Server) createSplitModeHandler(r *http.Request, clients map[string]*MCPClient) (ModeHandler, error) {
 	path := strings.Trim(r.URL.Path, "/")
 	pathSegments := strings.SplitN(path, "/", 2)
 
@@ -118,55 +318,84 @@ func (s *Server) createSplitModeHandler(r *http.Request) (ModeHandler, error) {
 	}
 
 	serverName := pathSegments[0]
-	mcpClient, exists := s.mcpClients[serverName]
+	mcpClient, exists := clients[serverName]
 
 	if !exists {
 		return nil, fmt.Errorf("Server %s not found", serverName)
 	}
 
 	return &SplitModeHandler{
-		server:    s,
-		mcpClient: mcpClient,
-		logger:    WithComponentAndServer("server", serverName),
+		server:     s,
+		serverName: serverName,
+		mcpClient:  mcpClient,
+		logger:     WithComponentAndServer("server", serverName),
 	}, nil
 }
 
 // createFlatModeHandler creates a handler for flat mode requests
-func (s *Server) createFlatModeHandler(r *http.Request) (ModeHandler, error) {
+func (s *Server) createFlatModeHandler(r *http.Request, clients map[string]*MCPClient) (ModeHandler, error) {
 	return &FlatModeHandler{
-		server: s,
-		logger: WithComponent("server"),
+		server:  s,
+		clients: clients,
+		logger:  WithComponent("server"),
 	}, nil
 }
 
 // processRequest handles the common request processing logic
-func (s *Server) processRequest(w http.ResponseWriter, r *http.Request, handler ModeHandler) {
-	s.initMu.RLock()
-	defer s.initMu.RUnlock()
+func (s *Server) processRequest(w http.ResponseWriter, r *http.Request, handler ModeHandler, ready bool) {
+	spanCtx, span := tracer().Start(
+		otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header)),
+		"mcp.request",
+		trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+	if serverName := handlerServerName(handler); serverName != "" {
+		span.SetAttributes(attrMCPServer.String(serverName))
+	}
 
-	if len(s.mcpClients) == 0 {
+	if !ready {
 		http.Error(w, "Service not ready", http.StatusServiceUnavailable)
 		return
 	}
 
-	logger, err := handler.validateRequest(r)
+	caller, logger, err := handler.validateRequest(r)
 	if err != nil {
-		logger.Error("Request validation failed", "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.ErrorContext(spanCtx, "Request validation failed", "error", err)
+		status := http.StatusBadRequest
+		var httpErr *httpError
+		if errors.As(err, &httpErr) {
+			status = httpErr.status
+		}
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		s.metrics.observeRequest("", handlerServerName(handler), "", httpStatusLabel(status))
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), status)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), defaultRequestTimeout)
-	defer cancel()
+	// Timeouts are applied per upstream request by MCPClient
+	ctx := withClientIP(withInboundHeaders(spanCtx, s.forwardableHeaders(r)), r)
+	if caller != nil {
+		ctx = withCaller(ctx, caller)
+		logger = logger.With("caller", caller.ID)
+		span.SetAttributes(attrEndUserID.String(caller.ID))
+	}
 
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxRequestBytes))
 	if err != nil {
-		logger.Error("Failed to read request body", "error", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			logger.WarnContext(ctx, "Request body too large", "limit_bytes", maxBytesErr.Limit)
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		logger.ErrorContext(ctx, "Failed to read request body", "error", err)
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
@@ -174,38 +403,66 @@ func (s *Server) processRequest(w http.ResponseWriter, r *http.Request, handler
 
 	var req JSONRPCRequest
 	if err := json.Unmarshal(body, &req); err != nil {
-		logger.Error("Failed to parse JSON-RPC request", "error", err)
-		writeJSONRPCError(w, -32700, "Parse error", nil, nil)
+		logger.ErrorContext(ctx, "Failed to parse JSON-RPC request", "error", err)
+		writeJSONRPCError(w, -32700, "Parse error", errorData(ctx, nil), nil)
 		return
 	}
 
 	if err := validateJSONRPCRequest(&req); err != nil {
-		logger.Error("Invalid JSON-RPC request", "error", err)
-		writeJSONRPCError(w, -32600, err.Error(), nil, req.ID)
+		logger.ErrorContext(ctx, "Invalid JSON-RPC request", "error", err)
+		writeJSONRPCError(w, -32600, err.Error(), errorData(ctx, nil), req.ID)
 		return
 	}
 
-	logger.Info("Processing MCP method", "method", req.Method)
+	logger.InfoContext(ctx, "Processing MCP method", "method", req.Method)
+	span.SetName(req.Method)
+	span.SetAttributes(attrMCPMethod.String(req.Method))
+	if toolName, ok := req.Params["name"].(string); ok && req.Method == "tools/call" {
+		span.SetName(req.Method + " " + toolName)
+		span.SetAttributes(attrMCPTool.String(toolName))
+	}
 	var result interface{}
 
 	switch req.Method {
 	case "initialize":
 		result = &mcp.InitializeResult{
 			ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
+			Capabilities: mcp.ServerCapabilities{
+				Logging: &struct{}{},
+			},
 		}
 	case "notifications/initialized":
 		result = &mcp.InitializedNotification{}
+	case "ping":
+		result = struct{}{}
 	case "tools/list":
 		result, err = handler.handleToolsList(ctx)
 	case "tools/call":
 		result, err = handler.handleToolsCall(ctx, req.Params)
+	case "logging/setLevel":
+		result, err = s.handleSetLevel(ctx, s.validAdminToken(r.Header.Get(adminTokenHeader)), req.Params)
 	default:
 		err = fmt.Errorf("method not found: %s", req.Method)
 	}
+	s.observeRequest(handler, &req, result, err)
+	toolResult, _ := result.(*mcp.CallToolResult)
+	endSpan(span, toolResult, err)
 
 	if err != nil {
-		logger.Error("MCP error", "error", err)
-		writeJSONRPCError(w, -32603, "Internal error", err.Error(), req.ID)
+		logger.ErrorContext(ctx, "MCP error", "error", s.redactor.redactString(err.Error()))
+		var rpcErr *rpcError
+		if errors.As(err, &rpcErr) {
+			if rpcErr.retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rpcErr.retryAfter.Seconds()))))
+			}
+			status := rpcErr.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			writeJSONRPCErrorStatus(w, status, rpcErr.code, rpcErr.message, errorData(ctx, rpcErr.data), req.ID)
+			return
+		}
+		writeJSONRPCError(w, -32603, "Internal error", errorData(ctx, err.Error()), req.ID)
 		return
 	}
 
@@ -219,15 +476,169 @@ func (s *Server) processRequest(w http.ResponseWriter, r *http.Request, handler
 	// Send JSON response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		logger.Error("Failed to encode response", "error", err)
+		logger.ErrorContext(ctx, "Failed to encode response", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 }
 
+// observeRequest counts the JSON-RPC request in the metrics
+func (s *Server) observeRequest(handler ModeHandler, req *JSONRPCRequest, result interface{}, err error) {
+	toolResult, _ := result.(*mcp.CallToolResult)
+	var tool string
+	if req.Method == "tools/call" {
+		toolName, _ := req.Params["name"].(string)
+		tool = toolLabel(toolName, toolResult != nil, handlerClients(handler))
+	}
+	status, _ := callStatus(toolResult, err)
+	s.metrics.observeRequest(methodLabel(req.Method), handlerServerName(handler), tool, status)
+}
+
+// handlerClients returns the clients the handler routes requests to
+func handlerClients(handler ModeHandler) map[string]*MCPClient {
+	switch h := handler.(type) {
+	case *SplitModeHandler:
+		return map[string]*MCPClient{h.serverName: h.mcpClient}
+	case *FlatModeHandler:
+		return h.clients
+	}
+	return nil
+}
+
+// handlerServerName returns the upstream server of split mode requests
+func handlerServerName(handler ModeHandler) string {
+	if h, ok := handler.(*SplitModeHandler); ok {
+		return h.serverName
+	}
+	return ""
+}
+
+// authenticate identifies the caller of the request
+func (s *Server) authenticate(r *http.Request) (*Caller, error) {
+	if s.authenticator != nil {
+		return s.authenticator.Authenticate(r)
+	}
+	// A verified client certificate wins over the identity header, which any
+	// client can set
+	if caller := callerFromClientCert(r); caller != nil {
+		return caller, nil
+	}
+	return callerFromIdentityHeader(r, s.identityHeader), nil
+}
+
+// callTool calls a tool on the given server on behalf of the caller in ctx
+// and records the call in the audit log
+func (s *Server) callTool(ctx context.Context, serverName string, client *MCPClient, toolName string, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	if s.logger.Enabled(ctx, slog.LevelDebug) {
+		s.logger.DebugContext(ctx, "Tool call arguments",
+			"server", serverName,
+			"tool", toolName,
+			"arguments", s.redactor.redactArguments(args))
+	}
+
+	start := time.Now()
+	result, err := s.authorizeAndCallTool(ctx, serverName, client, toolName, args)
+	latency := time.Since(start)
+	s.audit.record(ctx, serverName, toolName, args, result, err, latency)
+	s.metrics.observeToolCall(serverName, toolLabel(toolName, result != nil, map[string]*MCPClient{serverName: client}), result, err, latency)
+	s.recordRecentCall(ctx, serverName, toolName, result, err, latency)
+
+	if err == nil && s.logger.Enabled(ctx, slog.LevelDebug) {
+		s.logger.DebugContext(ctx, "Tool call result",
+			"server", serverName,
+			"tool", toolName,
+			"result", s.redactor.redactValue(result))
+	}
+	return result, err
+}
+
+// authorizeAndCallTool runs the access checks, rate limits and approval of
+// the tool call, then calls the tool
+func (s *Server) authorizeAndCallTool(ctx context.Context, serverName string, client *MCPClient, toolName string, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	if caller := callerFromContext(ctx); !caller.allows(serverName, toolName) {
+		s.logger.WarnContext(ctx, "Tool call denied by access scope",
+			"caller", caller.ID,
+			"server", serverName,
+			"tool", toolName)
+		return nil, newForbiddenError(fmt.Sprintf("caller is not allowed to call tool %s", toolName))
+	}
+	if decision := s.policy.evaluate(ctx, callerFromContext(ctx), serverName, toolName, args); !decision.allowed {
+		s.logger.WarnContext(ctx, "Tool call denied by policy",
+			"caller", callerID(ctx),
+			"server", serverName,
+			"tool", toolName,
+			"policy", decision.rule)
+		return nil, newPolicyDeniedError(decision)
+	}
+	if err := s.takeRateLimits(ctx, client, toolName); err != nil {
+		s.logger.WarnContext(ctx, "Tool call rate limited",
+			"caller", callerID(ctx),
+			"server", serverName,
+			"tool", toolName,
+			"error", err)
+		return nil, err
+	}
+	if client.requiresApproval(toolName) {
+		if err := s.approvals.await(ctx, serverName, toolName, args); err != nil {
+			return nil, err
+		}
+	}
+	result, err := client.CallTool(ctx, toolName, args)
+	if err != nil {
+		return nil, err
+	}
+	result = client.outputFilter.apply(toolName, result)
+	return client.resultLimits.apply(toolName, result), nil
+}
+
+// takeRateLimits checks the rate limits of the tool, its server and the proxy,
+// from the most specific to the least. A rejected call takes no tokens.
+func (s *Server) takeRateLimits(ctx context.Context, client *MCPClient, toolName string) error {
+	now := time.Now()
+	if err := client.rateLimits.take(toolName, now); err != nil {
+		return err
+	}
+	if err := s.rateLimiter.take(ctx, now); err != nil {
+		client.rateLimits.giveBack(toolName)
+		return err
+	}
+	return nil
+}
+
+// filterTools returns the tools of the server that the caller in ctx may call
+func (s *Server) filterTools(ctx context.Context, serverName string, tools []mcp.Tool) []mcp.Tool {
+	caller := callerFromContext(ctx)
+	filtered := make([]mcp.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if caller.allows(serverName, tool.Name) && s.policy.mayAllow(caller, serverName, tool.Name) {
+			filtered = append(filtered, tool)
+		}
+	}
+	return filtered
+}
+
+// newForbiddenError creates the JSON-RPC error returned when the caller may not do something
+func newForbiddenError(reason string) *rpcError {
+	return &rpcError{
+		code:    errCodeForbidden,
+		message: "Forbidden",
+		data:    map[string]interface{}{"reason": reason},
+	}
+}
+
 // SplitModeHandler implementations
-func (h *SplitModeHandler) validateRequest(r *http.Request) (*slog.Logger, error) {
-	return h.logger, nil
+func (h *SplitModeHandler) validateRequest(r *http.Request) (*Caller, *slog.Logger, error) {
+	caller, err := h.server.authenticate(r)
+	if err != nil {
+		return nil, h.logger, err
+	}
+	if !caller.allowsServer(h.serverName) {
+		return nil, h.logger, &httpError{
+			status:  http.StatusForbidden,
+			message: fmt.Sprintf("Access to server %s is not allowed", h.serverName),
+		}
+	}
+	return caller, h.logger, nil
 }
 
 func (h *SplitModeHandler) handleToolsList(ctx context.Context) (interface{}, error) {
@@ -235,33 +646,37 @@ func (h *SplitModeHandler) handleToolsList(ctx context.Context) (interface{}, er
 	if err != nil {
 		return nil, err
 	}
-	return &mcp.ListToolsResult{Tools: tools}, nil
+	return &mcp.ListToolsResult{Tools: h.server.filterTools(ctx, h.serverName, tools)}, nil
 }
 
 func (h *SplitModeHandler) handleToolsCall(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	toolName, _ := params["name"].(string)
-	h.logger.Info("Calling MCP tool", "tool", toolName)
+	h.logger.InfoContext(ctx, "Calling MCP tool", "tool", toolName)
 
 	// Try type assertion for arguments, use empty map if it fails
 	args, ok := params["arguments"].(map[string]interface{})
 	if !ok {
-		h.logger.Warn("Arguments type assertion failed, using empty map")
+		h.logger.WarnContext(ctx, "Arguments type assertion failed, using empty map")
 		args = make(map[string]interface{})
 	}
-	return h.mcpClient.CallTool(ctx, params["name"].(string), args)
+	return h.server.callTool(ctx, h.serverName, h.mcpClient, toolName, args)
 }
 
 // FlatModeHandler implementations
-func (h *FlatModeHandler) validateRequest(r *http.Request) (*slog.Logger, error) {
-	return h.logger, nil
+func (h *FlatModeHandler) validateRequest(r *http.Request) (*Caller, *slog.Logger, error) {
+	caller, err := h.server.authenticate(r)
+	if err != nil {
+		return nil, h.logger, err
+	}
+	return caller, h.logger, nil
 }
 
 func (h *FlatModeHandler) handleToolsList(ctx context.Context) (interface{}, error) {
-	return h.server.listAllTools(ctx), nil
+	return h.server.listAllTools(ctx, h.clients), nil
 }
 
 func (h *FlatModeHandler) handleToolsCall(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	return h.server.callToolAuto(ctx, params)
+	return h.server.callToolAuto(ctx, h.clients, params)
 }
 
 func validateJSONRPCRequest(req *JSONRPCRequest) error {
@@ -278,6 +693,46 @@ func validateJSONRPCRequest(req *JSONRPCRequest) error {
 }
 
 func writeJSONRPCError(w http.ResponseWriter, code int, message string, data interface{}, id interface{}) {
+	writeJSONRPCErrorStatus(w, http.StatusOK, code, message, data, id)
+}
+
+// requestIDFromHeader returns the request ID sent by the client, or a new one
+// if there is none or it is not a short printable token
+func requestIDFromHeader(header http.Header) string {
+	id := header.Get(requestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		return randomHex(16)
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return randomHex(16)
+		}
+	}
+	return id
+}
+
+// errorData adds the request ID of ctx to the data of a JSON-RPC error.
+// Data that is not an object is moved to the "detail" field.
+func errorData(ctx context.Context, data interface{}) interface{} {
+	requestID := requestIDFromContext(ctx)
+	if requestID == "" {
+		return data
+	}
+	fields := map[string]interface{}{"requestId": requestID}
+	switch d := data.(type) {
+	case nil:
+	case map[string]interface{}:
+		for k, v := range d {
+			fields[k] = v
+		}
+	default:
+		fields["detail"] = d
+	}
+	return fields
+}
+
+// writeJSONRPCErrorStatus writes a JSON-RPC error response with the given HTTP status
+func writeJSONRPCErrorStatus(w http.ResponseWriter, status, code int, message string, data interface{}, id interface{}) {
 	resp := JSONRPCResponse{
 		JSONRPC: jsonrpcVersion,
 		Error: &struct {
@@ -293,7 +748,7 @@ func writeJSONRPCError(w http.ResponseWriter, code int, message string, data int
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		logger := WithComponent("server")
@@ -311,10 +766,7 @@ func (s *Server) handleLiveness(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
-	s.initMu.RLock()
-	defer s.initMu.RUnlock()
-
-	ready := len(s.mcpClients) > 0
+	ready := s.healthPolicy.ready(s.serverHealth()) && !s.draining.Load()
 
 	if ready {
 		w.WriteHeader(http.StatusOK)
@@ -331,56 +783,86 @@ func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Start starts the server
-func (s *Server) Start(port string) error {
+// routes returns the handler serving all endpoints of the proxy
+func (s *Server) routes() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health/liveness", s.handleLiveness)
 	mux.HandleFunc("/health/readiness", s.handleReadiness)
+	mux.HandleFunc("GET /health/servers", s.handleServerHealth)
+	mux.Handle("/metrics", s.metrics.Handler())
+	if s.approvals != nil {
+		mux.HandleFunc("GET /approvals", s.approvals.handleList)
+		mux.HandleFunc("POST /approvals/{id}", s.approvals.handleDecision)
+	}
 	mux.HandleFunc("/", s.handleJSONRPC)
+	return mux
+}
 
+// Start starts the server
+func (s *Server) Start(port string) error {
 	addr := ":" + port
 	s.server = &http.Server{
-		Addr:    addr,
-		Handler: mux,
+		Addr:      addr,
+		Handler:   s.routes(),
+		TLSConfig: s.tlsConfig,
 	}
 
+	if s.tlsConfig != nil {
+		s.logger.Info("Starting MCP https proxy server", "address", addr,
+			"client_auth", s.tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert)
+		return s.server.ListenAndServeTLS("", "")
+	}
 	s.logger.Info("Starting MCP http proxy server", "address", addr)
 	return s.server.ListenAndServe()
 }
 
+// StartAdmin starts the admin API listener on the given address
+func (s *Server) StartAdmin(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("Starting admin API server", "address", addr)
+	return s.adminServer.Serve(ln)
+}
+
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.adminServer.Shutdown(ctx); err != nil {
+		s.logger.Error("Admin API server shutdown error", "error", err)
+	}
 	return s.server.Shutdown(ctx)
 }
 
 // listAllTools aggregates tools from all connected MCP servers
-func (s *Server) listAllTools(ctx context.Context) *mcp.ListToolsResult {
+func (s *Server) listAllTools(ctx context.Context, clients map[string]*MCPClient) *mcp.ListToolsResult {
 	toolMap := make(map[string]mcp.Tool)
 	conflictLog := make(map[string][]string)
 
-	serverNames := make([]string, 0, len(s.mcpClients))
-	for name := range s.mcpClients {
+	serverNames := make([]string, 0, len(clients))
+	for name := range clients {
 		serverNames = append(serverNames, name)
 	}
 	sort.Strings(serverNames)
 
 	for _, serverName := range serverNames {
-		client := s.mcpClients[serverName]
+		client := clients[serverName]
 		tools, err := s.getToolsWithCache(ctx, serverName, client)
 		if err != nil {
-			s.logger.Error("Failed to list tools from server", "server", serverName, "error", err)
+			s.logger.ErrorContext(ctx, "Failed to list tools from server", "server", serverName, "error", s.redactor.redactString(err.Error()))
 			continue
 		}
+		tools = s.filterTools(ctx, serverName, tools)
 
 		for _, tool := range tools {
 			if _, exists := toolMap[tool.Name]; exists {
 				if conflictLog[tool.Name] == nil {
 					firstServer := "unknown"
-					for prevServerName := range s.mcpClients {
+					for prevServerName := range clients {
 						if prevServerName == serverName {
 							break
 						}
-						if prevTools, err := s.getToolsWithCache(ctx, prevServerName, s.mcpClients[prevServerName]); err == nil {
+						if prevTools, err := s.getToolsWithCache(ctx, prevServerName, clients[prevServerName]); err == nil {
 							for _, prevTool := range prevTools {
 								if prevTool.Name == tool.Name {
 									firstServer = prevServerName
@@ -395,7 +877,7 @@ func (s *Server) listAllTools(ctx context.Context) *mcp.ListToolsResult {
 					conflictLog[tool.Name] = []string{firstServer}
 				}
 				conflictLog[tool.Name] = append(conflictLog[tool.Name], serverName)
-				s.logger.Warn("Tool name conflict in tools/list",
+				s.logger.WarnContext(ctx, "Tool name conflict in tools/list",
 					"tool", tool.Name,
 					"keeping_from", conflictLog[tool.Name][0],
 					"conflicting_server", serverName)
@@ -414,66 +896,94 @@ func (s *Server) listAllTools(ctx context.Context) *mcp.ListToolsResult {
 }
 
 // callToolAuto automatically routes tool calls to the appropriate MCP server
-func (s *Server) callToolAuto(ctx context.Context, params map[string]interface{}) (*mcp.CallToolResult, error) {
+func (s *Server) callToolAuto(ctx context.Context, clients map[string]*MCPClient, params map[string]interface{}) (*mcp.CallToolResult, error) {
 	toolName, ok := params["name"].(string)
 	if !ok {
 		return nil, fmt.Errorf("tool name is required")
 	}
 
+	args, _ := params["arguments"].(map[string]interface{})
+	if args == nil {
+		args = make(map[string]interface{})
+	}
+
 	var foundServers []string
+	var deniedServers []string
+	caller := callerFromContext(ctx)
 
-	serverNames := make([]string, 0, len(s.mcpClients))
-	for name := range s.mcpClients {
+	serverNames := make([]string, 0, len(clients))
+	for name := range clients {
 		serverNames = append(serverNames, name)
 	}
 	sort.Strings(serverNames)
 
 	for _, serverName := range serverNames {
-		client := s.mcpClients[serverName]
+		client := clients[serverName]
 		tools, err := s.getToolsWithCache(ctx, serverName, client)
 		if err != nil {
-			s.logger.Error("Failed to list tools for tool call routing", "server", serverName, "error", err)
+			s.logger.ErrorContext(ctx, "Failed to list tools for tool call routing", "server", serverName, "error", s.redactor.redactString(err.Error()))
 			continue
 		}
 
 		for _, tool := range tools {
 			if tool.Name == toolName {
+				// Route to the first server on which the caller may call the tool
+				if !caller.allows(serverName, toolName) {
+					deniedServers = append(deniedServers, serverName)
+					continue
+				}
 				foundServers = append(foundServers, serverName)
 				if len(foundServers) == 1 {
-					args, _ := params["arguments"].(map[string]interface{})
-					if args == nil {
-						args = make(map[string]interface{})
-					}
-					s.logger.Info("Calling tool", "tool", toolName, "server", serverName)
-					return client.CallTool(ctx, toolName, args)
+					s.logger.InfoContext(ctx, "Calling tool", "tool", toolName, "server", serverName)
+					return s.callTool(ctx, serverName, client, toolName, args)
 				}
 			}
 		}
 	}
 
+	if len(deniedServers) > 0 {
+		s.logger.WarnContext(ctx, "Tool call denied by access scope",
+			"caller", caller.ID,
+			"tool", toolName,
+			"servers", deniedServers)
+		err := newForbiddenError(fmt.Sprintf("caller is not allowed to call tool %s", toolName))
+		s.audit.record(ctx, "", toolName, args, nil, err, 0)
+		return nil, err
+	}
+
 	if len(foundServers) > 1 {
-		s.logger.Warn("Tool name conflict detected during call",
+		s.logger.WarnContext(ctx, "Tool name conflict detected during call",
 			"tool", toolName,
 			"servers", foundServers,
 			"selected", foundServers[0])
 	}
 
-	return nil, fmt.Errorf("tool not found: %s", toolName)
+	err := fmt.Errorf("tool not found: %s", toolName)
+	s.audit.record(ctx, "", toolName, args, nil, err, 0)
+	return nil, err
 }
 
 // getToolsWithCache returns tools with 60s TTL caching for flat mode
 func (s *Server) getToolsWithCache(ctx context.Context, serverName string, client MCPClientInterface) ([]mcp.Tool, error) {
+	ctx, span := tracer().Start(ctx, "getToolsWithCache", trace.WithAttributes(attrMCPServer.String(serverName)))
+	defer span.End()
+
 	s.cacheMu.RLock()
 	if tools, exists := s.toolsCache[serverName]; exists {
 		if expiry, hasExpiry := s.cacheExpiry[serverName]; hasExpiry && time.Now().Before(expiry) {
 			s.cacheMu.RUnlock()
+			s.metrics.observeToolsCache(serverName, true)
+			span.SetAttributes(attrCacheHit.Bool(true))
 			return tools, nil
 		}
 	}
 	s.cacheMu.RUnlock()
+	s.metrics.observeToolsCache(serverName, false)
+	span.SetAttributes(attrCacheHit.Bool(false))
 
 	tools, err := client.ListTools(ctx)
 	if err != nil {
+		endSpan(span, nil, err)
 		return nil, err
 	}
 
@@ -439,3 +439,33 @@ func TestCacheErrorHandling(t *testing.T) {
 		t.Errorf("Expected 1 cached tool, got %d", len(cachedTools))
 	}
 }
+
+// TestMaxRequestBytes tests that request bodies over the limit are rejected
+func TestMaxRequestBytes(t *testing.T) {
+	client := newInProcessMCPClient(t, &MCPClientConfig{}, echoMetaTool())
+	server := NewServer(map[string]*MCPClient{"a": client}, false, WithMaxRequestBytes(128))
+
+	tests := []struct {
+		name       string
+		body       string
+		statusCode int
+	}{
+		{"Within limit", `{"jsonrpc":"2.0","method":"tools/list","id":1}`, http.StatusOK},
+		{"Over limit", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"whoami","arguments":{"q":"` + strings.Repeat("x", 200) + `"}},"id":1}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.handleJSONRPC(w, req)
+			if w.Code != tt.statusCode {
+				t.Errorf("expected status code %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if NewServer(nil, false, WithMaxRequestBytes(0)).maxRequestBytes != defaultMaxRequestBytes {
+		t.Error("expected a non-positive limit to keep the default")
+	}
+}
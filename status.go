@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const defaultRecentCalls = 50
+
+// recentCall is a finished tool call shown on the status page
+type recentCall struct {
+	Time      time.Time
+	Caller    string
+	Server    string
+	Tool      string
+	Status    string
+	Error     string
+	LatencyMs float64
+}
+
+// callHistory keeps the most recent tool calls
+type callHistory struct {
+	mu    sync.Mutex
+	calls []recentCall
+	next  int
+	full  bool
+}
+
+func newCallHistory(size int) *callHistory {
+	if size <= 0 {
+		size = defaultRecentCalls
+	}
+	return &callHistory{calls: make([]recentCall, size)}
+}
+
+// WithRecentCalls sets how many recent tool calls the status page shows.
+// Non-positive values keep the default.
+func WithRecentCalls(n int) ServerOption {
+	return func(s *Server) {
+		s.recentCalls = newCallHistory(n)
+	}
+}
+
+// add stores the call, replacing the oldest one if the history is full
+func (h *callHistory) add(call recentCall) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls[h.next] = call
+	h.next = (h.next + 1) % len(h.calls)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// snapshot returns the stored calls, newest first
+func (h *callHistory) snapshot() []recentCall {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := h.next
+	if h.full {
+		n = len(h.calls)
+	}
+	calls := make([]recentCall, 0, n)
+	for i := 1; i <= n; i++ {
+		calls = append(calls, h.calls[(h.next-i+len(h.calls))%len(h.calls)])
+	}
+	return calls
+}
+
+// recordRecentCall adds a finished tool call to the history of the status page
+func (s *Server) recordRecentCall(ctx context.Context, serverName, toolName string, result *mcp.CallToolResult, err error, latency time.Duration) {
+	call := recentCall{
+		Time:      time.Now(),
+		Caller:    callerID(ctx),
+		Server:    serverName,
+		Tool:      toolName,
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+	}
+	call.Status, _ = callStatus(result, err)
+	if err != nil {
+		call.Error = s.redactor.redactString(err.Error())
+	}
+	s.recentCalls.add(call)
+}
+
+// handleStatus serves GET /status, a read-only HTML page with the servers,
+// their tools and the recent tool calls
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Time     time.Time
+		Draining bool
+		InFlight int64
+		Servers  []upstreamStatus
+		Calls    []recentCall
+	}{
+		Time:     time.Now(),
+		Draining: s.draining.Load(),
+		InFlight: s.inFlight.Load(),
+		Servers:  s.upstreamStatuses(),
+		Calls:    s.recentCalls.snapshot(),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := statusTemplate.Execute(w, data); err != nil {
+		s.logger.ErrorContext(r.Context(), "Failed to render status page", "error", err)
+	}
+}
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"duration": func(seconds float64) string {
+		return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+	},
+	"deref": func(n *int) int {
+		if n == nil {
+			return 0
+		}
+		return *n
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="10">
+<title>mcp-proxy status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.running, .ok { color: #070; }
+.failed, .unhealthy, .error, .rejected, .tool_error { color: #b00; }
+.starting, .disabled { color: #777; }
+</style>
+</head>
+<body>
+<h1>mcp-proxy status</h1>
+<p>{{.Time.Format "2006-01-02 15:04:05 MST"}}{{if .Draining}} &middot; <strong>draining</strong>{{end}} &middot; {{.InFlight}} requests in flight</p>
+
+<h2>Servers</h2>
+<table>
+<tr><th>Server</th><th>Transport</th><th>Status</th><th>Uptime</th><th>Last error</th><th>Tools</th></tr>
+{{range .Servers}}<tr>
+<td>{{.Name}}</td>
+<td>{{.Transport}}</td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td>{{if .StartedAt}}{{duration .UptimeSeconds}}{{end}}</td>
+<td>{{.Error}}</td>
+<td>{{if .Tools}}{{deref .Tools}}: {{range $i, $name := .ToolNames}}{{if $i}}, {{end}}{{$name}}{{end}}{{else if or (eq .Status "running") (eq .Status "unhealthy")}}unknown{{end}}</td>
+</tr>
+{{else}}<tr><td colspan="6">No servers configured</td></tr>
+{{end}}</table>
+
+<h2>Recent tool calls</h2>
+<table>
+<tr><th>Time</th><th>Caller</th><th>Server</th><th>Tool</th><th>Outcome</th><th>Latency</th><th>Error</th></tr>
+{{range .Calls}}<tr>
+<td>{{.Time.Format "15:04:05"}}</td>
+<td>{{.Caller}}</td>
+<td>{{.Server}}</td>
+<td>{{.Tool}}</td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td>{{printf "%.1f" .LatencyMs}} ms</td>
+<td>{{.Error}}</td>
+</tr>
+{{else}}<tr><td colspan="7">No tool calls yet</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
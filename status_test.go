@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCallHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		tools    []string
+		expected []string
+	}{
+		{name: "Empty", size: 3, expected: []string{}},
+		{name: "Not full", size: 3, tools: []string{"a", "b"}, expected: []string{"b", "a"}},
+		{name: "Full", size: 3, tools: []string{"a", "b", "c"}, expected: []string{"c", "b", "a"}},
+		{name: "Wrapped", size: 3, tools: []string{"a", "b", "c", "d", "e"}, expected: []string{"e", "d", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newCallHistory(tt.size)
+			for _, tool := range tt.tools {
+				h.add(recentCall{Tool: tool})
+			}
+			got := []string{}
+			for _, call := range h.snapshot() {
+				got = append(got, call.Tool)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("snapshot() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStatusPage(t *testing.T) {
+	url := newTestUpstream(t)
+	server := newManagedTestServer(t, map[string]*MCPClientConfig{
+		"remote": {Name: "remote", Url: url},
+		"local":  {Name: "local", Command: "/nonexistent/mcp-server"},
+	})
+	client := server.clients()["remote"]
+	if _, err := server.getToolsWithCache(context.Background(), "remote", client); err != nil {
+		t.Fatalf("getToolsWithCache failed: %v", err)
+	}
+	if _, err := server.callTool(context.Background(), "remote", client, "ping", nil); err != nil {
+		t.Fatalf("callTool failed: %v", err)
+	}
+	server.recordRecentCall(context.Background(), "remote", "<script>", nil, newForbiddenError("no"), 0)
+
+	tests := []struct {
+		name       string
+		user       string
+		password   string
+		statusCode int
+		contains   []string
+	}{
+		{name: "Missing token", statusCode: http.StatusUnauthorized},
+		{name: "Wrong token", user: "admin", password: "nope", statusCode: http.StatusUnauthorized},
+		{
+			name:       "Page",
+			user:       "admin",
+			password:   "admin-secret",
+			statusCode: http.StatusOK,
+			contains: []string{
+				"<td>remote</td>", "<td>streamable-http</td>", `<td class="running">running</td>`, "1: ping",
+				"<td>local</td>", "<td>stdio</td>", `<td class="failed">failed</td>`,
+				"<td>ping</td>", `<td class="ok">ok</td>`,
+				"&lt;script&gt;", `<td class="rejected">rejected</td>`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/status", nil)
+			if tt.password != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			w := httptest.NewRecorder()
+			server.adminRoutes().ServeHTTP(w, req)
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+			if tt.statusCode == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic") {
+				t.Errorf("expected a basic authentication challenge, got %q", w.Header().Get("WWW-Authenticate"))
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("expected page to contain %q:\n%s", s, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRecordRecentCallRedactsErrors(t *testing.T) {
+	redactor, err := NewRedactor(&RedactionConfig{Patterns: []string{`sk-[a-z0-9]+`}})
+	if err != nil {
+		t.Fatalf("NewRedactor failed: %v", err)
+	}
+	server := NewServer(map[string]*MCPClient{}, false, WithRedactor(redactor))
+
+	server.recordRecentCall(context.Background(), "a", "tool", mcp.NewToolResultError("bad"), context.DeadlineExceeded, 0)
+	server.recordRecentCall(context.Background(), "a", "tool", nil, &rpcError{code: -32603, message: "key sk-abc123 leaked"}, 0)
+
+	calls := server.recentCalls.snapshot()
+	if len(calls) != 2 || strings.Contains(calls[0].Error, "sk-abc123") || calls[1].Status != auditStatusError {
+		t.Errorf("unexpected recent calls %+v", calls)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStderrBufferLines = 100
+
+	stderrFormatPlain = "plain"
+	stderrFormatJSON  = "json"
+	stderrFormatText  = "text"
+	stderrFormatAuto  = "auto"
+)
+
+var (
+	// level=info or level="warn" anywhere in a logfmt style line
+	stderrLogfmtLevel = regexp.MustCompile(`(?i)\blevel=["']?([a-z]+)`)
+	// INFO, [warn] or ERROR: at the start of the line
+	stderrPrefixLevel = regexp.MustCompile(`^\s*\[?([A-Za-z]+)\]?(?::|\s|$)`)
+)
+
+// stderrLine is a line a subprocess wrote to stderr
+type stderrLine struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// stderrBuffer keeps the most recent stderr lines of a subprocess
+type stderrBuffer struct {
+	mu    sync.Mutex
+	lines []stderrLine
+	next  int
+	full  bool
+}
+
+func newStderrBuffer(size int) *stderrBuffer {
+	if size <= 0 {
+		size = defaultStderrBufferLines
+	}
+	return &stderrBuffer{lines: make([]stderrLine, size)}
+}
+
+// stderrBufferLines returns the number of stderr lines kept for a server
+func stderrBufferLines(ext *Extensions) int {
+	if ext == nil || ext.Stderr == nil || ext.Stderr.BufferLines <= 0 {
+		return defaultStderrBufferLines
+	}
+	return ext.Stderr.BufferLines
+}
+
+// add stores the line, replacing the oldest one if the buffer is full
+func (b *stderrBuffer) add(line stderrLine) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// snapshot returns the stored lines, oldest first
+func (b *stderrBuffer) snapshot() []stderrLine {
+	if b == nil {
+		return []stderrLine{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]stderrLine{}, b.lines[:b.next]...)
+	}
+	return append(append([]stderrLine{}, b.lines[b.next:]...), b.lines[:b.next]...)
+}
+
+// validateStderrExtensions checks the stderr settings of a server
+func validateStderrExtensions(ext *Extensions) error {
+	if ext == nil || ext.Stderr == nil {
+		return nil
+	}
+	switch ext.Stderr.Format {
+	case "", stderrFormatPlain, stderrFormatJSON, stderrFormatText, stderrFormatAuto:
+		return nil
+	default:
+		return fmt.Errorf("invalid stderr format %q", ext.Stderr.Format)
+	}
+}
+
+// logStderr logs a stderr line of the subprocess at its parsed severity and
+// keeps it in the buffer
+func (c *MCPClient) logStderr(line string) {
+	format := stderrFormatPlain
+	if c.config.Extensions != nil && c.config.Extensions.Stderr != nil && c.config.Extensions.Stderr.Format != "" {
+		format = c.config.Extensions.Stderr.Format
+	}
+
+	level, message := parseStderrLine(format, line)
+	c.stderr.add(stderrLine{Time: time.Now().UTC(), Level: level.String(), Message: message})
+	c.logger.Log(context.Background(), level, "subprocess stderr", "message", message)
+}
+
+// parseStderrLine returns the severity and message of a stderr line. Lines
+// without a recognizable severity are logged as warnings.
+func parseStderrLine(format, line string) (slog.Level, string) {
+	if format == stderrFormatJSON || format == stderrFormatAuto {
+		if level, message, ok := parseJSONStderrLine(line); ok {
+			return level, message
+		}
+	}
+	if format == stderrFormatText || format == stderrFormatAuto {
+		if m := stderrLogfmtLevel.FindStringSubmatch(line); m != nil {
+			if level, ok := parseLevelName(m[1]); ok {
+				return level, line
+			}
+		}
+		if m := stderrPrefixLevel.FindStringSubmatch(line); m != nil {
+			if level, ok := parseLevelName(m[1]); ok {
+				return level, line
+			}
+		}
+	}
+	return slog.LevelWarn, line
+}
+
+// parseJSONStderrLine reads the level and message of a JSON log line
+func parseJSONStderrLine(line string) (slog.Level, string, bool) {
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return 0, "", false
+	}
+
+	level, ok := slog.LevelWarn, false
+	for _, key := range []string{"level", "severity", "lvl"} {
+		switch v := record[key].(type) {
+		case string:
+			level, ok = parseLevelName(v)
+		case float64:
+			level, ok = parseLevelNumber(v)
+		}
+		if ok {
+			break
+		}
+	}
+	if !ok {
+		return 0, "", false
+	}
+
+	message := line
+	for _, key := range []string{"msg", "message"} {
+		if v, isString := record[key].(string); isString {
+			message = v
+			break
+		}
+	}
+	return level, message, true
+}
+
+// parseLevelName maps common level names to slog levels
+func parseLevelName(name string) (slog.Level, bool) {
+	switch strings.ToLower(name) {
+	case "trace", "debug", "dbg":
+		return slog.LevelDebug, true
+	case "info", "notice", "inf":
+		return slog.LevelInfo, true
+	case "warn", "warning", "wrn":
+		return slog.LevelWarn, true
+	case "error", "err", "fatal", "critical", "crit", "panic", "alert", "emergency":
+		return slog.LevelError, true
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		return parseLevelNumber(float64(n))
+	}
+	return 0, false
+}
+
+// parseLevelNumber maps pino / bunyan style numeric levels to slog levels
+func parseLevelNumber(n float64) (slog.Level, bool) {
+	switch {
+	case n <= 0:
+		return 0, false
+	case n < 30:
+		return slog.LevelDebug, true
+	case n < 40:
+		return slog.LevelInfo, true
+	case n < 50:
+		return slog.LevelWarn, true
+	default:
+		return slog.LevelError, true
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseStderrLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		line        string
+		wantLevel   slog.Level
+		wantMessage string
+	}{
+		{name: "Plain", format: "plain", line: "level=error boom", wantLevel: slog.LevelWarn, wantMessage: "level=error boom"},
+		{name: "JSON level", format: "json", line: `{"level":"info","msg":"started"}`, wantLevel: slog.LevelInfo, wantMessage: "started"},
+		{name: "JSON severity", format: "json", line: `{"severity":"ERROR","message":"failed"}`, wantLevel: slog.LevelError, wantMessage: "failed"},
+		{name: "JSON numeric level", format: "json", line: `{"level":20,"msg":"details"}`, wantLevel: slog.LevelDebug, wantMessage: "details"},
+		{name: "JSON without level", format: "json", line: `{"msg":"hi"}`, wantLevel: slog.LevelWarn, wantMessage: `{"msg":"hi"}`},
+		{name: "JSON format with text line", format: "json", line: "INFO ready", wantLevel: slog.LevelWarn, wantMessage: "INFO ready"},
+		{name: "Logfmt level", format: "text", line: `time=now level="debug" msg=x`, wantLevel: slog.LevelDebug, wantMessage: `time=now level="debug" msg=x`},
+		{name: "Bracket prefix", format: "text", line: "[ERROR] disk full", wantLevel: slog.LevelError, wantMessage: "[ERROR] disk full"},
+		{name: "Colon prefix", format: "text", line: "info: listening", wantLevel: slog.LevelInfo, wantMessage: "info: listening"},
+		{name: "Unknown prefix", format: "text", line: "Starting server", wantLevel: slog.LevelWarn, wantMessage: "Starting server"},
+		{name: "Auto with JSON", format: "auto", line: `{"level":"warning","msg":"slow"}`, wantLevel: slog.LevelWarn, wantMessage: "slow"},
+		{name: "Auto with text", format: "auto", line: "DEBUG cache miss", wantLevel: slog.LevelDebug, wantMessage: "DEBUG cache miss"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, message := parseStderrLine(tt.format, tt.line)
+			if level != tt.wantLevel || message != tt.wantMessage {
+				t.Errorf("parseStderrLine() = %v, %q, want %v, %q", level, message, tt.wantLevel, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestStderrBuffer(t *testing.T) {
+	b := newStderrBuffer(3)
+	if got := b.snapshot(); len(got) != 0 {
+		t.Fatalf("expected an empty buffer, got %v", got)
+	}
+
+	for _, message := range []string{"a", "b", "c", "d", "e"} {
+		b.add(stderrLine{Message: message})
+	}
+	var messages []string
+	for _, line := range b.snapshot() {
+		messages = append(messages, line.Message)
+	}
+	if strings.Join(messages, ",") != "c,d,e" {
+		t.Errorf("expected the 3 most recent lines, got %v", messages)
+	}
+
+	var nilBuffer *stderrBuffer
+	nilBuffer.add(stderrLine{Message: "x"})
+	if got := nilBuffer.snapshot(); got == nil || len(got) != 0 {
+		t.Errorf("expected an empty snapshot from a nil buffer, got %v", got)
+	}
+}
+
+func TestValidateStderrExtensions(t *testing.T) {
+	if err := validateStderrExtensions(&Extensions{Stderr: &StderrExtensions{Format: "auto"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := validateStderrExtensions(&Extensions{Stderr: &StderrExtensions{Format: "xml"}}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestLogStderr(t *testing.T) {
+	buf := captureLogs(t)
+	c := &MCPClient{
+		config: &MCPClientConfig{
+			Name:       "github",
+			Extensions: &Extensions{Stderr: &StderrExtensions{Format: "auto"}},
+		},
+		logger: WithComponentAndServer("mcp_client", "github"),
+		stderr: newStderrBuffer(10),
+	}
+
+	c.logStderr(`{"level":"error","msg":"token expired"}`)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to parse log record %q: %v", buf.String(), err)
+	}
+	if record["level"] != "ERROR" || record["server_name"] != "github" || record["message"] != "token expired" {
+		t.Errorf("unexpected log record %v", record)
+	}
+	lines := c.stderr.snapshot()
+	if len(lines) != 1 || lines[0].Level != "ERROR" || lines[0].Message != "token expired" {
+		t.Errorf("unexpected buffered lines %v", lines)
+	}
+}
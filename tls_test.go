@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert is a locally generated certificate and its key
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert creates a certificate signed by the parent, or a self-signed CA if parent is nil
+func newTestCert(t *testing.T, subject pkix.Name, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// writeFiles writes the certificate and key as PEM files and returns their paths
+func (c *testCert) writeFiles(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	ca := newTestCert(t, pkix.Name{CommonName: "test-ca"}, nil, 0)
+	serverCert := newTestCert(t, pkix.Name{CommonName: "mcp-proxy"}, ca, x509.ExtKeyUsageServerAuth)
+	certFile, keyFile := serverCert.writeFiles(t)
+	caFile, _ := ca.writeFiles(t)
+	emptyFile := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(emptyFile, nil, 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		cert, key, ca  string
+		wantErr        bool
+		wantClientAuth tls.ClientAuthType
+	}{
+		{name: "TLS only", cert: certFile, key: keyFile, wantClientAuth: tls.NoClientCert},
+		{name: "Mutual TLS", cert: certFile, key: keyFile, ca: caFile, wantClientAuth: tls.RequireAndVerifyClientCert},
+		{name: "Missing key", cert: certFile, wantErr: true},
+		{name: "Client CA without certificate", ca: caFile, wantErr: true},
+		{name: "Key does not match", cert: certFile, key: caFile, wantErr: true},
+		{name: "Empty client CA", cert: certFile, key: keyFile, ca: emptyFile, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := newServerTLSConfig(tt.cert, tt.key, tt.ca)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newServerTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.ClientAuth != tt.wantClientAuth {
+				t.Errorf("expected client auth %v, got %v", tt.wantClientAuth, config.ClientAuth)
+			}
+		})
+	}
+}
+
+// mtlsTestServer serves the proxy over mutual TLS
+type mtlsTestServer struct {
+	url   string
+	ca    *testCert
+	roots *x509.CertPool
+}
+
+func startMTLSServer(t *testing.T, server *Server) *mtlsTestServer {
+	t.Helper()
+	ca := newTestCert(t, pkix.Name{CommonName: "test-ca"}, nil, 0)
+	serverCert := newTestCert(t, pkix.Name{CommonName: "mcp-proxy"}, ca, x509.ExtKeyUsageServerAuth)
+	certFile, keyFile := serverCert.writeFiles(t)
+	caFile, _ := ca.writeFiles(t)
+
+	tlsConfig, err := newServerTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("newServerTLSConfig failed: %v", err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(server.handleJSONRPC))
+	ts.TLS = tlsConfig
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	return &mtlsTestServer{url: ts.URL, ca: ca, roots: roots}
+}
+
+// client returns an HTTP client presenting a certificate with the given subject,
+// signed by the server's client CA. An empty common name means no certificate.
+func (m *mtlsTestServer) client(t *testing.T, cn string, ou ...string) *http.Client {
+	t.Helper()
+	config := &tls.Config{RootCAs: m.roots}
+	if cn != "" {
+		cert := newTestCert(t, pkix.Name{CommonName: cn, OrganizationalUnit: ou}, m.ca, x509.ExtKeyUsageClientAuth)
+		config.Certificates = []tls.Certificate{cert.tlsCertificate()}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+}
+
+func postJSONRPC(t *testing.T, client *http.Client, url, body string) (int, string, error) {
+	t.Helper()
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(buf), err
+}
+
+func TestMutualTLSCallerIdentity(t *testing.T) {
+	c := newInProcessMCPClient(t, &MCPClientConfig{
+		Extensions: &Extensions{Forward: &ForwardExtensions{Identity: true}},
+	}, echoMetaTool())
+	server := NewServer(map[string]*MCPClient{"server1": c}, true)
+	ts := startMTLSServer(t, server)
+
+	// Clients without a certificate cannot connect
+	if _, _, err := postJSONRPC(t, ts.client(t, ""), ts.url+"/server1", `{"jsonrpc":"2.0","method":"tools/list","id":1}`); err == nil {
+		t.Error("expected connection without client certificate to fail")
+	}
+
+	client := ts.client(t, "billing-service", "payments")
+	status, body, err := postJSONRPC(t, client, ts.url+"/server1", `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"whoami"},"id":1}`)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", status, body)
+	}
+	if !strings.Contains(body, `\"id\":\"billing-service\"`) || !strings.Contains(body, `\"groups\":[\"payments\"]`) {
+		t.Errorf("expected certificate subject as caller identity, got %s", body)
+	}
+}
+
+func TestMutualTLSIgnoresIdentityHeader(t *testing.T) {
+	c := newInProcessMCPClient(t, &MCPClientConfig{
+		Extensions: &Extensions{Forward: &ForwardExtensions{Identity: true}},
+	}, echoMetaTool())
+	server := NewServer(map[string]*MCPClient{"server1": c}, true, WithIdentityHeader("X-User-Id"))
+	ts := startMTLSServer(t, server)
+
+	req, err := http.NewRequest("POST", ts.url+"/server1", strings.NewReader(`{"jsonrpc":"2.0","method":"tools/call","params":{"name":"whoami"},"id":1}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("X-User-Id", "admin")
+	resp, err := ts.client(t, "billing-service").Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if !strings.Contains(string(body), `\"id\":\"billing-service\"`) || strings.Contains(string(body), "admin") {
+		t.Errorf("expected the certificate subject to win over the spoofed header, got %s", body)
+	}
+}
+
+func TestMutualTLSClientCertScopes(t *testing.T) {
+	server := newScopedTestServer(t, false)
+	auth, err := NewAuthenticator(&AuthConfig{ClientCerts: []ClientCertConfig{
+		{Subject: "search-bot", AccessScope: AccessScope{Tools: []string{"search_*"}}},
+	}})
+	if err != nil {
+		t.Fatalf("NewAuthenticator failed: %v", err)
+	}
+	server.authenticator = auth
+	ts := startMTLSServer(t, server)
+
+	tests := []struct {
+		name     string
+		cn       string
+		body     string
+		status   int
+		contains string
+	}{
+		{
+			name:     "Listed subject may call tools in its scope",
+			cn:       "search-bot",
+			body:     `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"search_docs"},"id":1}`,
+			status:   http.StatusOK,
+			contains: "called search_docs",
+		},
+		{
+			name:     "Listed subject may not call tools outside its scope",
+			cn:       "search-bot",
+			body:     `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"delete_issue"},"id":2}`,
+			status:   http.StatusOK,
+			contains: "Forbidden",
+		},
+		{
+			name:   "Unlisted subject is rejected",
+			cn:     "other-service",
+			body:   `{"jsonrpc":"2.0","method":"tools/list","id":3}`,
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body, err := postJSONRPC(t, ts.client(t, tt.cn), ts.url, tt.body)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if status != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, status, body)
+			}
+			if !strings.Contains(body, tt.contains) {
+				t.Errorf("expected response to contain %q, got %s", tt.contains, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName         = "github.com/ubie-oss/mcp-proxy"
+	defaultServiceName = "mcp-proxy"
+
+	tracingExporterOTLP   = "otlp"
+	tracingExporterStdout = "stdout"
+	tracingExporterFile   = "file"
+)
+
+// Span attributes
+const (
+	attrMCPMethod = attribute.Key("mcp.method.name")
+	attrMCPServer = attribute.Key("mcp.server")
+	attrMCPTool   = attribute.Key("mcp.tool.name")
+	attrCacheHit  = attribute.Key("mcp.tools_cache.hit")
+	attrEndUserID = attribute.Key("enduser.id")
+)
+
+// tracer returns the tracer of the proxy. It does nothing unless tracing is set up.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// SetupTracing installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes and stops the exporter.
+func SetupTracing(cfg *TracingConfig) (func(context.Context) error, error) {
+	exporter, closeExporter, err := newSpanExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	ratio := 1.0
+	if cfg.SampleRatio != nil {
+		ratio = *cfg.SampleRatio
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("sampleRatio must be between 0 and 1")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeExporter != nil {
+			if closeErr := closeExporter(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// newSpanExporter creates the exporter of the config and, for the file
+// exporter, a function that closes the file
+func newSpanExporter(cfg *TracingConfig) (sdktrace.SpanExporter, func() error, error) {
+	switch cfg.Exporter {
+	case "", tracingExporterOTLP:
+		// OTEL_EXPORTER_OTLP_* environment variables apply to unset options
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		return exporter, nil, nil
+	case tracingExporterStdout:
+		exporter, err := stdouttrace.New()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		return exporter, nil, nil
+	case tracingExporterFile:
+		if cfg.Path == "" {
+			return nil, nil, fmt.Errorf("path is required for the file exporter")
+		}
+		file, err := newRotatingWriter(cfg.Path, 0, 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+		return exporter, file.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid tracing exporter %q", cfg.Exporter)
+	}
+}
+
+// endSpan sets the status of the span from the outcome of the call
+func endSpan(span trace.Span, result *mcp.CallToolResult, err error) {
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	case result != nil && result.IsError:
+		span.SetStatus(codes.Error, "tool returned an error")
+	}
+}
+
+// traceMeta returns the trace context of ctx as _meta fields for upstream servers
+func traceMeta(ctx context.Context) map[string]interface{} {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	meta := make(map[string]interface{}, len(carrier))
+	for k, v := range carrier {
+		meta[k] = v
+	}
+	return meta
+}
+
+// injectTraceHeaders adds the trace context of ctx to the upstream HTTP headers
+func injectTraceHeaders(ctx context.Context, headers map[string]string) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return headers
+	}
+	if headers == nil {
+		headers = make(map[string]string, len(carrier))
+	}
+	for k, v := range carrier {
+		headers[k] = v
+	}
+	return headers
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// useTestTracing installs a tracer provider that records spans in memory
+// and restores the global tracing setup when the test ends
+func useTestTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	restoreGlobalTracing(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return exporter
+}
+
+func restoreGlobalTracing(t *testing.T) {
+	provider := otel.GetTracerProvider()
+	propagator := otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+}
+
+func TestSetupTracing(t *testing.T) {
+	ratio := 0.5
+	invalidRatio := 2.0
+	tests := []struct {
+		name    string
+		config  TracingConfig
+		wantErr bool
+	}{
+		{name: "OTLP exporter", config: TracingConfig{Endpoint: "localhost:4318", Insecure: true, SampleRatio: &ratio}},
+		{name: "Stdout exporter", config: TracingConfig{Exporter: "stdout"}},
+		{name: "File exporter", config: TracingConfig{Exporter: "file", Path: filepath.Join(t.TempDir(), "traces.jsonl")}},
+		{name: "File exporter without path", config: TracingConfig{Exporter: "file"}, wantErr: true},
+		{name: "Unknown exporter", config: TracingConfig{Exporter: "zipkin"}, wantErr: true},
+		{name: "Invalid sample ratio", config: TracingConfig{Exporter: "stdout", SampleRatio: &invalidRatio}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restoreGlobalTracing(t)
+			shutdown, err := SetupTracing(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetupTracing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if shutdown != nil {
+				shutdown(context.Background())
+			}
+		})
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	restoreGlobalTracing(t)
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := SetupTracing(&TracingConfig{Exporter: "file", Path: path, ServiceName: "proxy-test"})
+	if err != nil {
+		t.Fatalf("SetupTracing failed: %v", err)
+	}
+
+	_, span := tracer().Start(context.Background(), "test-span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read trace file: %v", err)
+	}
+	if !strings.Contains(string(content), `"Name":"test-span"`) || !strings.Contains(string(content), "proxy-test") {
+		t.Errorf("expected the span in the trace file, got %s", content)
+	}
+}
+
+func TestTracingAcrossHops(t *testing.T) {
+	exporter := useTestTracing(t)
+
+	client := newInProcessMCPClient(t, &MCPClientConfig{}, echoMetaTool())
+	server := NewServer(map[string]*MCPClient{"a": client}, false)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc":"2.0","method":"tools/call","params":{"name":"whoami"},"id":1}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	server.handleJSONRPC(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+		if got := span.SpanContext.TraceID().String(); got != traceID {
+			t.Errorf("span %s has trace ID %s, want %s", span.Name, got, traceID)
+		}
+	}
+	request, ok := spans["tools/call whoami"]
+	if !ok || spans["getToolsWithCache"].Name == "" {
+		t.Fatalf("expected request, cache and upstream spans, got %v", exporter.GetSpans().Snapshots())
+	}
+	if got := request.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("expected the request span to continue the incoming trace, got parent %s", got)
+	}
+
+	var upstream tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "tools/call whoami" && span.Parent.SpanID() == request.SpanContext.SpanID() {
+			upstream = span
+		}
+	}
+	if upstream.Name == "" {
+		t.Fatal("expected an upstream call span under the request span")
+	}
+
+	var resp struct {
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Result.Content) == 0 {
+		t.Fatalf("Failed to parse response %s: %v", w.Body.String(), err)
+	}
+	var meta map[string]string
+	json.Unmarshal([]byte(resp.Result.Content[0].Text), &meta)
+	want := "00-" + traceID + "-" + upstream.SpanContext.SpanID().String() + "-01"
+	if meta["traceparent"] != want {
+		t.Errorf("expected traceparent %s in _meta, got %v", want, meta)
+	}
+}
+
+func TestTraceHeadersSentUpstream(t *testing.T) {
+	useTestTracing(t)
+
+	ctx, span := tracer().Start(context.Background(), "parent")
+	defer span.End()
+
+	c := &MCPClient{config: &MCPClientConfig{}}
+	headers := c.forwardedHeaders(ctx)
+	want := "00-" + span.SpanContext().TraceID().String() + "-" + span.SpanContext().SpanID().String() + "-01"
+	if headers["traceparent"] != want {
+		t.Errorf("expected traceparent %s, got %v", want, headers)
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const defaultInitTimeout = 60 * time.Second
+
+// How long a failed start waits for the rest of the stderr of the subprocess
+const stderrDrainTimeout = 500 * time.Millisecond
+
+const (
+	transportStdio          = "stdio"
+	transportSSE            = "sse"
+	transportStreamableHTTP = "streamable-http"
+)
+
+const (
+	upstreamStatusRunning   = "running"
+	upstreamStatusUnhealthy = "unhealthy"
+	upstreamStatusStarting  = "starting"
+	upstreamStatusFailed    = "failed"
+	upstreamStatusDisabled  = "disabled"
+)
+
+// upstreamState is the runtime state of a configured MCP server
+type upstreamState struct {
+	config   *MCPClientConfig
+	disabled bool
+
+	// Redacted error of the last failed start, cleared when the server starts
+	lastErr string
+	// Recent stderr lines of the server, kept across restarts and failed starts
+	stderr *stderrBuffer
+}
+
+// upstreamStatus describes a configured MCP server in the admin API
+type upstreamStatus struct {
+	Name          string     `json:"name"`
+	Transport     string     `json:"transport"`
+	Status        string     `json:"status"`
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	UptimeSeconds float64    `json:"uptimeSeconds,omitempty"`
+	Tools         *int       `json:"tools,omitempty"`
+	Error         string     `json:"error,omitempty"`
+
+	// Names of the tools the server publishes after filtering
+	ToolNames []string `json:"-"`
+}
+
+// WithInitTimeout sets the timeout of starting and initializing an MCP client.
+// Non-positive values keep the default.
+func WithInitTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		if timeout > 0 {
+			s.initTimeout = timeout
+		}
+	}
+}
+
+// StartClients starts the clients of the configured MCP servers, except the
+// disabled ones, and makes them available once all of them are initialized.
+// ctx must stay valid for the lifetime of the clients.
+func (s *Server) StartClients(ctx context.Context, configs map[string]*MCPClientConfig) {
+	s.manageMu.Lock()
+	defer s.manageMu.Unlock()
+
+	upstreams := make(map[string]*upstreamState, len(configs))
+	for name, cfg := range configs {
+		upstreams[name] = &upstreamState{
+			config:   cfg,
+			disabled: cfg.Extensions != nil && cfg.Extensions.Disabled,
+		}
+	}
+	s.initMu.Lock()
+	s.upstreams = upstreams
+	s.initMu.Unlock()
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	clients := make(map[string]*MCPClient)
+	for _, name := range names {
+		if upstreams[name].disabled {
+			s.logger.Info("Skipping disabled MCP server", "server_name", name)
+			continue
+		}
+
+		client, err := s.startClient(ctx, name, configs[name], s.stderrBuffer(upstreams[name]))
+		s.initMu.Lock()
+		upstreams[name].lastErr = s.redactedError(err)
+		s.initMu.Unlock()
+		if err != nil {
+			s.logger.Error("Failed to initialize MCP client", "server_name", name, "error", s.redactor.redactString(err.Error()))
+			continue
+		}
+		clients[name] = client
+		s.logger.Info("MCP Server initialized successfully", "server_name", name)
+	}
+
+	s.initMu.Lock()
+	s.mcpClients = clients
+	s.initMu.Unlock()
+}
+
+// startClient creates the client of the named server and initializes it
+// within the init timeout. The client writes its stderr lines to stderr if it
+// is not nil.
+func (s *Server) startClient(ctx context.Context, name string, cfg *MCPClientConfig, stderr *stderrBuffer) (*MCPClient, error) {
+	client, err := NewMCPClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MCP client: %w", err)
+	}
+	client.redactor = s.redactor
+	if stderr != nil {
+		client.stderr = stderr
+	}
+
+	// The client keeps using ctx after Initialize returns, e.g. for the
+	// subprocess, so the timeout is applied without cancelling it
+	initStart := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Initialize(ctx)
+		done <- err
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(s.initTimeout):
+		err = fmt.Errorf("initialization timed out after %s", s.initTimeout)
+	}
+	s.metrics.observeUpstreamInit(name, time.Since(initStart), err)
+	if err != nil {
+		// Keep what a subprocess that exited wrote before it is closed
+		client.waitStderr(stderrDrainTimeout)
+		client.Close()
+		return nil, err
+	}
+
+	if s.logger.Enabled(ctx, slog.LevelDebug) {
+		LogConfig(s.logger, name, cfg.Env)
+	}
+	return client, nil
+}
+
+// RestartServer starts a new client of the named server and replaces the
+// running one with it. The running client is kept if the new one fails to start.
+func (s *Server) RestartServer(ctx context.Context, name string) error {
+	s.manageMu.Lock()
+	defer s.manageMu.Unlock()
+
+	state, err := s.upstream(name)
+	if err != nil {
+		return err
+	}
+	s.initMu.RLock()
+	disabled := state.disabled
+	s.initMu.RUnlock()
+	if disabled {
+		return &httpError{status: http.StatusConflict, message: fmt.Sprintf("server %s is disabled", name)}
+	}
+
+	if err := s.replaceClient(ctx, name, state); err != nil {
+		return err
+	}
+	s.metrics.observeUpstreamRestart(name)
+	s.logger.InfoContext(ctx, "MCP server restarted", "server_name", name)
+	return nil
+}
+
+// EnableServer starts the client of a disabled server
+func (s *Server) EnableServer(ctx context.Context, name string) error {
+	s.manageMu.Lock()
+	defer s.manageMu.Unlock()
+
+	state, err := s.upstream(name)
+	if err != nil {
+		return err
+	}
+	s.initMu.Lock()
+	_, running := s.mcpClients[name]
+	state.disabled = false
+	s.initMu.Unlock()
+	if running {
+		return nil
+	}
+
+	if err := s.replaceClient(ctx, name, state); err != nil {
+		return err
+	}
+	s.logger.InfoContext(ctx, "MCP server enabled", "server_name", name)
+	return nil
+}
+
+// DisableServer stops the client of the named server until it is enabled again
+func (s *Server) DisableServer(ctx context.Context, name string) error {
+	s.manageMu.Lock()
+	defer s.manageMu.Unlock()
+
+	state, err := s.upstream(name)
+	if err != nil {
+		return err
+	}
+	s.initMu.Lock()
+	state.disabled = true
+	s.initMu.Unlock()
+
+	s.removeClient(name)
+	s.logger.InfoContext(ctx, "MCP server disabled", "server_name", name)
+	return nil
+}
+
+// replaceClient starts a client from the config of the server and puts it in
+// place of the running one, which is closed. The running client is kept if
+// the new one fails to start. The caller holds manageMu.
+func (s *Server) replaceClient(ctx context.Context, name string, state *upstreamState) error {
+	client, err := s.startClient(ctx, name, state.config, s.stderrBuffer(state))
+	s.initMu.Lock()
+	state.lastErr = s.redactedError(err)
+	var previous *MCPClient
+	if err == nil {
+		previous = s.mcpClients[name]
+		s.mcpClients = withClient(s.mcpClients, name, client)
+	}
+	s.initMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.flushToolsCache(name)
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// stderrBuffer returns the stderr buffer of the server, creating it if the
+// server has none or the configured size changed. The caller holds manageMu.
+func (s *Server) stderrBuffer(state *upstreamState) *stderrBuffer {
+	lines := stderrBufferLines(state.config.Extensions)
+	s.initMu.Lock()
+	defer s.initMu.Unlock()
+	if state.stderr == nil || len(state.stderr.lines) != lines {
+		state.stderr = newStderrBuffer(lines)
+	}
+	return state.stderr
+}
+
+// removeClient stops the running client of the named server, if any. The
+// caller holds manageMu.
+func (s *Server) removeClient(name string) {
+	s.initMu.Lock()
+	client := s.mcpClients[name]
+	if client != nil {
+		s.mcpClients = withClient(s.mcpClients, name, nil)
+	}
+	s.initMu.Unlock()
+
+	s.flushToolsCache(name)
+	if client != nil {
+		client.Close()
+	}
+}
+
+// upstream returns the state of the named server
+func (s *Server) upstream(name string) (*upstreamState, error) {
+	s.initMu.RLock()
+	defer s.initMu.RUnlock()
+	state, ok := s.upstreams[name]
+	if !ok {
+		return nil, &httpError{status: http.StatusNotFound, message: fmt.Sprintf("unknown server %s", name)}
+	}
+	return state, nil
+}
+
+// upstreamStatuses describes all configured servers, sorted by name. The
+// tools come from the tools cache, so that describing the servers never
+// waits for them; they are unknown until the server's tools are listed.
+func (s *Server) upstreamStatuses() []upstreamStatus {
+	s.initMu.RLock()
+	clients := s.mcpClients
+	statuses := make([]upstreamStatus, 0, len(s.upstreams))
+	for name, state := range s.upstreams {
+		status := upstreamStatus{
+			Name:      name,
+			Transport: transportName(state.config),
+			Status:    upstreamStatusStarting,
+			Error:     state.lastErr,
+		}
+		switch {
+		case state.disabled:
+			status.Status = upstreamStatusDisabled
+		case clients[name] != nil:
+			status.Status = upstreamStatusRunning
+		case state.lastErr != "":
+			status.Status = upstreamStatusFailed
+		}
+		statuses = append(statuses, status)
+	}
+	s.initMu.RUnlock()
+
+	for i := range statuses {
+		client := clients[statuses[i].Name]
+		if client == nil || statuses[i].Status != upstreamStatusRunning {
+			continue
+		}
+		if !client.startedAt.IsZero() {
+			startedAt := client.startedAt
+			statuses[i].StartedAt = &startedAt
+			statuses[i].UptimeSeconds = time.Since(startedAt).Seconds()
+		}
+		if !client.health.healthy() {
+			statuses[i].Status = upstreamStatusUnhealthy
+		}
+		if tools, ok := s.cachedTools(statuses[i].Name); ok {
+			count := len(tools)
+			statuses[i].Tools = &count
+			for _, tool := range tools {
+				statuses[i].ToolNames = append(statuses[i].ToolNames, tool.Name)
+			}
+			sort.Strings(statuses[i].ToolNames)
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// cachedTools returns the last listed tools of the server, even if the
+// cache entry expired
+func (s *Server) cachedTools(name string) ([]mcp.Tool, bool) {
+	s.cacheMu.RLock()
+	defer s.cacheMu.RUnlock()
+	tools, ok := s.toolsCache[name]
+	return tools, ok
+}
+
+// transportName returns the transport the client of the server uses
+func transportName(cfg *MCPClientConfig) string {
+	switch {
+	case cfg.Command != "":
+		return transportStdio
+	case cfg.Extensions != nil && cfg.Extensions.Sse:
+		return transportSSE
+	default:
+		return transportStreamableHTTP
+	}
+}
+
+// flushToolsCache drops the cached tools of the named server, or of all
+// servers if name is empty
+func (s *Server) flushToolsCache(name string) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	if name == "" {
+		s.toolsCache = make(map[string][]mcp.Tool)
+		s.cacheExpiry = make(map[string]time.Time)
+		return
+	}
+	delete(s.toolsCache, name)
+	delete(s.cacheExpiry, name)
+}
+
+// withClient returns a copy of clients with the named client replaced, or
+// removed if client is nil
+func withClient(clients map[string]*MCPClient, name string, client *MCPClient) map[string]*MCPClient {
+	updated := make(map[string]*MCPClient, len(clients)+1)
+	for k, v := range clients {
+		updated[k] = v
+	}
+	if client == nil {
+		delete(updated, name)
+	} else {
+		updated[name] = client
+	}
+	return updated
+}
+
+// redactedError returns the message of err with the redaction patterns
+// applied, or "" if err is nil
+func (s *Server) redactedError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return s.redactor.redactString(err.Error())
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+)
+
+// newTestUpstream returns the URL of a streamable HTTP MCP server with a ping tool
+func newTestUpstream(t *testing.T) string {
+	t.Helper()
+	srv := mcpserver.NewMCPServer("upstream", "1.0.0", mcpserver.WithToolCapabilities(false))
+	srv.AddTool(mcp.NewTool("ping"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("pong"), nil
+	})
+	ts := mcpserver.NewTestStreamableHTTPServer(srv)
+	t.Cleanup(ts.Close)
+	return ts.URL + "/mcp"
+}
+
+// newManagedTestServer returns a server whose clients were started from the configs
+func newManagedTestServer(t *testing.T, configs map[string]*MCPClientConfig) *Server {
+	t.Helper()
+	server := NewServer(map[string]*MCPClient{}, false, WithAdminToken("admin-secret"), WithInitTimeout(2*time.Second))
+	server.StartClients(context.Background(), configs)
+	t.Cleanup(func() {
+		for _, client := range server.clients() {
+			client.Close()
+		}
+	})
+	return server
+}
+
+func doAdmin(server *Server, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	server.adminRoutes().ServeHTTP(w, req)
+	return w
+}
+
+func serverStatuses(t *testing.T, server *Server) map[string]upstreamStatus {
+	t.Helper()
+	w := doAdmin(server, "GET", "/admin/servers")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Servers []upstreamStatus `json:"servers"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	statuses := make(map[string]upstreamStatus)
+	for _, status := range body.Servers {
+		statuses[status.Name] = status
+	}
+	return statuses
+}
+
+func TestStartClients(t *testing.T) {
+	url := newTestUpstream(t)
+	server := newManagedTestServer(t, map[string]*MCPClientConfig{
+		"up":       {Name: "up", Url: url},
+		"disabled": {Name: "disabled", Url: url, Extensions: &Extensions{Disabled: true}},
+		"broken":   {Name: "broken", Command: "/nonexistent/mcp-server"},
+	})
+
+	// The tools are unknown until they are listed
+	if tools := serverStatuses(t, server)["up"].Tools; tools != nil {
+		t.Errorf("expected unknown tools before listing, got %d", *tools)
+	}
+	if _, err := server.getToolsWithCache(context.Background(), "up", server.clients()["up"]); err != nil {
+		t.Fatalf("getToolsWithCache failed: %v", err)
+	}
+
+	statuses := serverStatuses(t, server)
+	tests := []struct {
+		name   string
+		status string
+		tools  int
+	}{
+		{name: "up", status: upstreamStatusRunning, tools: 1},
+		{name: "disabled", status: upstreamStatusDisabled},
+		{name: "broken", status: upstreamStatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := statuses[tt.name]
+			if got.Status != tt.status {
+				t.Fatalf("expected status %s, got %+v", tt.status, got)
+			}
+			if tt.status == upstreamStatusRunning && (got.Tools == nil || *got.Tools != tt.tools || got.StartedAt == nil) {
+				t.Errorf("expected %d tools and a start time, got %+v", tt.tools, got)
+			}
+			if tt.status == upstreamStatusFailed && got.Error == "" {
+				t.Errorf("expected an error, got %+v", got)
+			}
+		})
+	}
+	if _, ok := server.clients()["disabled"]; ok {
+		t.Error("expected the disabled server not to be started")
+	}
+}
+
+func TestStartClientTimeout(t *testing.T) {
+	block := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { close(block) })
+
+	server := NewServer(map[string]*MCPClient{}, false, WithInitTimeout(100*time.Millisecond))
+	start := time.Now()
+	_, err := server.startClient(context.Background(), "slow", &MCPClientConfig{Url: ts.URL}, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the timeout to apply, took %s", elapsed)
+	}
+}
+
+func TestStartErrorsRedacted(t *testing.T) {
+	redactor, err := NewRedactor(&RedactionConfig{Patterns: []string{`secret-[a-z]+`}})
+	if err != nil {
+		t.Fatalf("NewRedactor failed: %v", err)
+	}
+	server := NewServer(map[string]*MCPClient{}, false, WithAdminToken("admin-secret"), WithRedactor(redactor), WithInitTimeout(2*time.Second))
+	server.StartClients(context.Background(), map[string]*MCPClientConfig{
+		"broken": {Name: "broken", Command: "/nonexistent/secret-token"},
+	})
+
+	restart := doAdmin(server, "POST", "/admin/servers/broken/restart")
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "Server list", body: doAdmin(server, "GET", "/admin/servers").Body.String()},
+		{name: "Restart", body: restart.Body.String()},
+		{name: "Status page", body: doAdmin(server, "GET", "/status").Body.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.Contains(tt.body, "secret-token") || !strings.Contains(tt.body, "nonexistent") {
+				t.Errorf("expected the redacted start error, got %s", tt.body)
+			}
+		})
+	}
+}
+
+func TestAdminServerManagement(t *testing.T) {
+	url := newTestUpstream(t)
+	server := newManagedTestServer(t, map[string]*MCPClientConfig{
+		"up": {Name: "up", Url: url},
+	})
+	first := server.clients()["up"]
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+		status     string
+		running    bool
+	}{
+		{name: "Unknown server", path: "/admin/servers/zzz/restart", statusCode: http.StatusNotFound},
+		{name: "Disable", path: "/admin/servers/up/disable", statusCode: http.StatusOK, status: upstreamStatusDisabled},
+		{name: "Restart disabled", path: "/admin/servers/up/restart", statusCode: http.StatusConflict},
+		{name: "Enable", path: "/admin/servers/up/enable", statusCode: http.StatusOK, status: upstreamStatusRunning, running: true},
+		{name: "Restart", path: "/admin/servers/up/restart", statusCode: http.StatusOK, status: upstreamStatusRunning, running: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doAdmin(server, "POST", tt.path)
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			var status upstreamStatus
+			json.Unmarshal(w.Body.Bytes(), &status)
+			if status.Status != tt.status {
+				t.Errorf("expected status %s, got %s", tt.status, w.Body.String())
+			}
+			client, running := server.clients()["up"]
+			if running != tt.running {
+				t.Errorf("expected running = %v, got %v", tt.running, running)
+			}
+			if running && client == first {
+				t.Error("expected a new client")
+			}
+		})
+	}
+
+	// The restarted client serves tool calls
+	result, err := server.clients()["up"].CallTool(context.Background(), "ping", nil)
+	if err != nil || len(result.Content) != 1 {
+		t.Errorf("expected the restarted client to work, got %v, %v", result, err)
+	}
+}
+
+func TestAdminFlushCache(t *testing.T) {
+	client := newInProcessMCPClient(t, &MCPClientConfig{}, echoMetaTool())
+	server := NewServer(map[string]*MCPClient{"a": client}, false, WithAdminToken("admin-secret"))
+	server.upstreams["a"] = &upstreamState{config: &MCPClientConfig{}}
+
+	tests := []struct {
+		name       string
+		path       string
+		statusCode int
+	}{
+		{name: "Unknown server", path: "/admin/cache/flush?server=zzz", statusCode: http.StatusNotFound},
+		{name: "One server", path: "/admin/cache/flush?server=a", statusCode: http.StatusOK},
+		{name: "All servers", path: "/admin/cache/flush", statusCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := server.getToolsWithCache(context.Background(), "a", client); err != nil {
+				t.Fatalf("getToolsWithCache failed: %v", err)
+			}
+			w := doAdmin(server, "POST", tt.path)
+			if w.Code != tt.statusCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.statusCode, w.Code, w.Body.String())
+			}
+			server.cacheMu.RLock()
+			_, cached := server.toolsCache["a"]
+			server.cacheMu.RUnlock()
+			if cached != (tt.statusCode != http.StatusOK) {
+				t.Errorf("expected cached = %v, got %v", tt.statusCode != http.StatusOK, cached)
+			}
+		})
+	}
+}
+
+func TestAdminDrain(t *testing.T) {
+	client := newInProcessMCPClient(t, &MCPClientConfig{}, echoMetaTool())
+	server := NewServer(map[string]*MCPClient{"a": client}, false, WithAdminToken("admin-secret"))
+	handler := server.routes()
+
+	status := func(path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(`{"jsonrpc":"2.0","method":"tools/list","id":1}`)))
+		return w.Code
+	}
+
+	// A request in flight keeps the drain waiting until the wait is over
+	server.inFlight.Add(1)
+	start := time.Now()
+	w := doAdmin(server, "POST", "/admin/drain?wait=100ms")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"draining":true`) || !strings.Contains(w.Body.String(), `"inFlight":1`) {
+		t.Fatalf("unexpected drain response %d: %s", w.Code, w.Body.String())
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("expected the drain to wait for the request in flight")
+	}
+	server.inFlight.Add(-1)
+
+	if code := status("/"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while draining, got %d", code)
+	}
+	if n := server.inFlight.Load(); n != 0 {
+		t.Errorf("expected rejected requests not to stay in flight, got %d", n)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/health/readiness", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected readiness to fail while draining, got %d", w.Code)
+	}
+
+	if w := doAdmin(server, "POST", "/admin/drain?wait=soon"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid wait, got %d", w.Code)
+	}
+
+	if w := doAdmin(server, "DELETE", "/admin/drain"); !strings.Contains(w.Body.String(), `"draining":false`) {
+		t.Errorf("expected the drain to be cancelled, got %s", w.Body.String())
+	}
+	if code := status("/"); code != http.StatusOK {
+		t.Errorf("expected 200 after the drain, got %d", code)
+	}
+}